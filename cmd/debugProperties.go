@@ -2,12 +2,12 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/chia-network/repo-content-updater/internal/config"
 	"github.com/chia-network/repo-content-updater/internal/repo"
 )
 
@@ -16,10 +16,13 @@ var debugPropertiesCmd = &cobra.Command{
 	Use:   "debug-properties",
 	Short: "Prints the resolved custom properties for repos in the org",
 	Long: `Fetches GitHub org custom properties and prints the values that
-repo-content-updater would use for each repo. Use --repo to inspect a single repo.`,
+repo-content-updater would use for each repo, along with the repo config merged from
+the org, team, custom property and repo layers and the layer each value came from. Use --repo and the other
+repo selection flags to inspect specific repos.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		content, err := repo.NewContent(
 			viper.GetString("templates"),
+			viper.GetString("partials"),
 			viper.GetString("github-org"),
 			viper.GetString("committer-name"),
 			viper.GetString("committer-email"),
@@ -27,12 +30,22 @@ repo-content-updater would use for each repo. Use --repo to inspect a single rep
 			viper.GetString("github-token"),
 		)
 		if err != nil {
-			log.Fatalf("Error creating content manager: %s", err.Error())
+			fatalf("Error creating content manager: %s", err.Error())
 		}
 
-		properties, err := content.GetResolvedProperties(viper.GetString("repo"))
+		cfg, err := config.LoadConfig(viper.GetString("config"), viper.GetStringSlice("config-overlay")...)
 		if err != nil {
-			log.Fatalf("Error fetching properties: %s", err.Error())
+			fatalf("error loading config: %s\n", err.Error())
+		}
+
+		sel, err := newSelector()
+		if err != nil {
+			fatalf("Error selecting repos: %s", err.Error())
+		}
+
+		properties, err := content.GetResolvedProperties(cfg, sel)
+		if err != nil {
+			fatalf("Error fetching properties: %s", err.Error())
 		}
 
 		if len(properties) == 0 {
@@ -50,6 +63,21 @@ repo-content-updater would use for each repo. Use --repo to inspect a single rep
 			props := properties[r]
 			fmt.Printf("%s:\n", r)
 			fmt.Printf("  bypass-pr: %v\n", props.BypassPR)
+
+			repoConfig, err := content.FetchRepoConfig(r)
+			if err != nil {
+				fmt.Printf("  config error: %s\n", err.Error())
+				continue
+			}
+			resolved, err := content.ResolveRepoConfig(r, repoConfig, cfg, props)
+			if err != nil {
+				fmt.Printf("  config error: %s\n", err.Error())
+				continue
+			}
+			fmt.Println("  config:")
+			for _, value := range resolved.Values() {
+				fmt.Printf("    %s: %s (from %s)\n", value.Key, value.Value, value.Layer)
+			}
 		}
 	},
 }
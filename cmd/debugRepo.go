@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -10,13 +11,14 @@ import (
 	"github.com/chia-network/repo-content-updater/internal/repo"
 )
 
-// debugRepoCmd allows debugging a single repo
+// debugRepoCmd allows debugging the selected repos
 var debugRepoCmd = &cobra.Command{
 	Use:   "debug-repo",
-	Short: "Processes the given repo for debugging",
+	Short: "Processes the selected repos for debugging",
 	Run: func(cmd *cobra.Command, args []string) {
 		content, err := repo.NewContent(
 			viper.GetString("templates"),
+			viper.GetString("partials"),
 			viper.GetString("github-org"),
 			viper.GetString("committer-name"),
 			viper.GetString("committer-email"),
@@ -24,17 +26,43 @@ var debugRepoCmd = &cobra.Command{
 			viper.GetString("github-token"),
 		)
 		if err != nil {
-			log.Fatalf("Error creating content manager: %s", err.Error())
+			fatalf("Error creating content manager: %s", err.Error())
 		}
 
-		cfg, err := config.LoadConfig(viper.GetString("config"))
+		cfg, err := config.LoadConfig(viper.GetString("config"), viper.GetStringSlice("config-overlay")...)
 		if err != nil {
-			log.Fatalf("error loading config: %s\n", err.Error())
+			fatalf("error loading config: %s\n", err.Error())
 		}
 
-		err = content.CheckFiles(viper.GetString("repo"), viper.GetStringSlice("file"), cfg, repo.CustomProperties{})
+		var files []config.FileRef
+		for _, file := range viper.GetStringSlice("file") {
+			files = append(files, config.FileRef{Name: file})
+		}
+
+		sel, err := newSelector()
 		if err != nil {
-			log.Fatalf("Error checking repo: %s", err.Error())
+			fatalf("Error selecting repos: %s", err.Error())
+		}
+		if sel.IsEmpty() {
+			fatalln("debug-repo requires --repo or another repo selection flag")
+		}
+
+		repos, err := content.SelectRepos(sel)
+		if err != nil {
+			fatalf("Error selecting repos: %s", err.Error())
+		}
+
+		failed := false
+		for _, repoName := range repos {
+			err = content.CheckFiles(repoName, files, cfg, repo.CustomProperties{})
+			if err != nil {
+				log.Printf("Error checking %s: %s", repoName, err.Error())
+				failed = true
+			}
+		}
+		content.Report().Print(os.Stdout)
+		if failed {
+			exit(1)
 		}
 	},
 }
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path"
 
@@ -18,28 +17,34 @@ var debugTemplateCmd = &cobra.Command{
 	Use:   "debug-template",
 	Short: "Renders the given template for debugging",
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadConfig(viper.GetString("config"))
+		cfg, err := config.LoadConfig(viper.GetString("config"), viper.GetStringSlice("config-overlay")...)
 		if err != nil {
-			log.Fatalf("error loading config: %s\n", err.Error())
+			fatalf("error loading config: %s\n", err.Error())
 		}
 
 		tmplContent, err := os.ReadFile(path.Join(viper.GetString("templates"), args[0]))
 		if err != nil {
-			log.Fatalln(err.Error())
+			fatalln(err.Error())
 		}
+		partials, err := repo.LoadPartials(viper.GetString("partials"))
+		if err != nil {
+			fatalf("error loading partials: %s\n", err.Error())
+		}
+
 		content, err := repo.ProcessTemplate(
 			tmplContent,
+			partials,
 			cfg.Variables,
 			viper.GetStringMapString("debug-template-vars"),
 		)
 		if err != nil {
-			log.Fatalln(err.Error())
+			fatalln(err.Error())
 		}
 
 		outputPath := viper.GetString("debug-template-output")
 		if outputPath != "" {
 			if err := os.WriteFile(outputPath, content, 0644); err != nil {
-				log.Fatalf("error writing output file: %s\n", err.Error())
+				fatalf("error writing output file: %s\n", err.Error())
 			}
 		} else {
 			fmt.Print(string(content))
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+// headersCmd represents the headers command
+var headersCmd = &cobra.Command{
+	Use:   "headers",
+	Short: "Updates license headers in source files of repos with the manage-headers flag",
+	Run: func(cmd *cobra.Command, args []string) {
+		content, err := repo.NewContent(
+			viper.GetString("templates"),
+			viper.GetString("partials"),
+			viper.GetString("github-org"),
+			viper.GetString("committer-name"),
+			viper.GetString("committer-email"),
+			viper.GetString("review-team"),
+			viper.GetString("github-token"),
+		)
+		if err != nil {
+			fatalf("Error creating content manager: %s", err.Error())
+		}
+
+		cfg, err := config.LoadConfig(viper.GetString("config"), viper.GetStringSlice("config-overlay")...)
+		if err != nil {
+			fatalf("error loading config: %s\n", err.Error())
+		}
+
+		sel, err := newSelector()
+		if err != nil {
+			fatalf("Error selecting repos: %s", err.Error())
+		}
+
+		err = content.CheckHeaders(cfg, sel)
+		content.Report().Print(os.Stdout)
+		if err != nil {
+			fatalln(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(headersCmd)
+}
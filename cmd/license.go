@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"log"
+	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,6 +17,7 @@ var licenseCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		content, err := repo.NewContent(
 			viper.GetString("templates"),
+			viper.GetString("partials"),
 			viper.GetString("github-org"),
 			viper.GetString("committer-name"),
 			viper.GetString("committer-email"),
@@ -24,17 +25,23 @@ var licenseCmd = &cobra.Command{
 			viper.GetString("github-token"),
 		)
 		if err != nil {
-			log.Fatalf("Error creating content manager: %s", err.Error())
+			fatalf("Error creating content manager: %s", err.Error())
 		}
 
-		cfg, err := config.LoadConfig(viper.GetString("config"))
+		cfg, err := config.LoadConfig(viper.GetString("config"), viper.GetStringSlice("config-overlay")...)
 		if err != nil {
-			log.Fatalf("error loading config: %s\n", err.Error())
+			fatalf("error loading config: %s\n", err.Error())
 		}
 
-		err = content.CheckLicenses(cfg, viper.GetString("repo"))
+		sel, err := newSelector()
 		if err != nil {
-			log.Fatalln(err.Error())
+			fatalf("Error selecting repos: %s", err.Error())
+		}
+
+		err = content.CheckLicenses(cfg, sel)
+		content.Report().Print(os.Stdout)
+		if err != nil {
+			fatalln(err.Error())
 		}
 	},
 }
@@ -2,17 +2,111 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/chia-network/repo-content-updater/internal/repo"
+	"github.com/chia-network/repo-content-updater/internal/source"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "repo-content-updater",
 	Short: "Keeps known files in a repo up to date",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return resolveSources(cmd)
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		cleanupSources()
+	},
+}
+
+// sourceResolver fetches any --config, --config-overlay, --templates or --partials locations
+// that point to a remote git repository
+var sourceResolver *source.Resolver
+
+// cleanupSources removes any checkouts of remote locations
+func cleanupSources() {
+	if sourceResolver != nil {
+		sourceResolver.Cleanup()
+	}
+}
+
+// exit removes any checkouts of remote locations before exiting, since os.Exit skips PersistentPostRun
+func exit(code int) {
+	cleanupSources()
+	os.Exit(code)
+}
+
+// fatalf is log.Fatalf, removing any checkouts of remote locations first
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	exit(1)
+}
+
+// fatalln is log.Fatalln, removing any checkouts of remote locations first
+func fatalln(v ...any) {
+	log.Println(v...)
+	exit(1)
+}
+
+// resolveSources replaces remote locations with paths to local checkouts, and records the
+// resolved commit SHAs as templates-revision and config-revision
+func resolveSources(cmd *cobra.Command) error {
+	sourceResolver = source.NewResolver(viper.GetString("github-token"))
+
+	// Partials default to the directory next to the templates, so remote templates bring their partials along
+	if !cmd.Flags().Changed("partials") {
+		if remote, ok := source.Parse(viper.GetString("templates")); ok {
+			remote.Path = path.Join(path.Dir(remote.Path), "partials")
+			viper.Set("partials", remote.String())
+		}
+	}
+
+	for _, key := range []string{"templates", "partials", "config"} {
+		local, revision, err := sourceResolver.Resolve(viper.GetString(key))
+		if err != nil {
+			return err
+		}
+		viper.Set(key, local)
+
+		switch key {
+		case "templates":
+			viper.Set("templates-revision", revision)
+		case "config":
+			viper.Set("config-revision", revision)
+		}
+	}
+
+	var overlays []string
+	for _, overlay := range viper.GetStringSlice("config-overlay") {
+		local, _, err := sourceResolver.Resolve(overlay)
+		if err != nil {
+			return err
+		}
+		overlays = append(overlays, local)
+	}
+	viper.Set("config-overlay", overlays)
+
+	return nil
+}
+
+// newSelector returns the repo selector built from the --repo, --exclude, --topic, --team-owned-by,
+// --repos-file, --visibility and --force-include flags
+func newSelector() (*repo.Selector, error) {
+	return repo.NewSelector(repo.Selector{
+		Repos:        viper.GetStringSlice("repo"),
+		Exclude:      viper.GetStringSlice("exclude"),
+		Topics:       viper.GetStringSlice("topic"),
+		TeamOwnedBy:  viper.GetStringSlice("team-owned-by"),
+		Visibility:   viper.GetStringSlice("visibility"),
+		ForceInclude: viper.GetStringSlice("force-include"),
+	}, viper.GetString("repos-file"))
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -20,14 +114,17 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		// Remote locations may have been fetched before the error
+		exit(1)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().String("config", "config.yaml", "template config file (default is config.yaml)")
-	rootCmd.PersistentFlags().String("templates", "templates", "Path to templates defined in the config. Defaults to ./templates")
+	rootCmd.PersistentFlags().String("config", "config.yaml", "template config file or config.d directory, or a git location such as https://github.com/org/repo.git//config.yaml?ref=main (default is config.yaml)")
+	rootCmd.PersistentFlags().StringSlice("config-overlay", nil, "Additional config file(s) or directories loaded after --config, replacing any files, groups or variables with the same name")
+	rootCmd.PersistentFlags().String("templates", "templates", "Path to templates defined in the config, or a git location such as https://github.com/org/repo.git//templates?ref=main. Defaults to ./templates")
+	rootCmd.PersistentFlags().String("partials", "partials", "Path to shared partial templates available to every template. Defaults to ./partials")
 	rootCmd.PersistentFlags().String("github-org", "Chia-Network", "The org to process")
 	rootCmd.PersistentFlags().String("committer-name", "Chia Automation", "The git user to use when making commits")
 	rootCmd.PersistentFlags().String("committer-email", "automation@chia.net", "The git email to use when making commits")
@@ -35,10 +132,19 @@ func init() {
 	rootCmd.PersistentFlags().String("github-token", "", "The token to use to auth to GitHub API and Push to Repos")
 	rootCmd.PersistentFlags().Bool("sign-commits", true, "Whether or not to sign commits")
 	rootCmd.PersistentFlags().Bool("push", true, "Whether or not to push and create the pull request")
-	rootCmd.PersistentFlags().String("repo", "", "If set, will apply only to a specific repo")
+	rootCmd.PersistentFlags().StringSlice("repo", nil, "If set, will apply only to repos matching these names or glob patterns, such as chia-*. Use the flag multiple times for multiple repos")
+	rootCmd.PersistentFlags().StringSlice("exclude", nil, "Repo names or glob patterns to never apply to")
+	rootCmd.PersistentFlags().StringSlice("topic", nil, "If set, will apply only to repos with at least one of these topics")
+	rootCmd.PersistentFlags().StringSlice("team-owned-by", nil, "If set, will apply only to repos where at least one of these team slugs has admin or maintain access")
+	rootCmd.PersistentFlags().StringSlice("visibility", nil, "If set, will apply only to repos with one of these visibilities (public, private, internal)")
+	rootCmd.PersistentFlags().StringSlice("force-include", nil, "Repo names or glob patterns to process even if they are archived, disabled, forks, empty or have a visibility not allowed by --visibility")
+	rootCmd.PersistentFlags().String("repos-file", "", "File listing repo names or glob patterns to apply to, one per line, in addition to --repo")
+	rootCmd.PersistentFlags().String("defaults-repo", ".github", "Repo in the org holding org and team config defaults under repo-content-updater/. Set to an empty string to disable")
 
 	cobra.CheckErr(viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config")))
+	cobra.CheckErr(viper.BindPFlag("config-overlay", rootCmd.PersistentFlags().Lookup("config-overlay")))
 	cobra.CheckErr(viper.BindPFlag("templates", rootCmd.PersistentFlags().Lookup("templates")))
+	cobra.CheckErr(viper.BindPFlag("partials", rootCmd.PersistentFlags().Lookup("partials")))
 	cobra.CheckErr(viper.BindPFlag("github-org", rootCmd.PersistentFlags().Lookup("github-org")))
 	cobra.CheckErr(viper.BindPFlag("committer-name", rootCmd.PersistentFlags().Lookup("committer-name")))
 	cobra.CheckErr(viper.BindPFlag("committer-email", rootCmd.PersistentFlags().Lookup("committer-email")))
@@ -47,6 +153,13 @@ func init() {
 	cobra.CheckErr(viper.BindPFlag("sign-commits", rootCmd.PersistentFlags().Lookup("sign-commits")))
 	cobra.CheckErr(viper.BindPFlag("push", rootCmd.PersistentFlags().Lookup("push")))
 	cobra.CheckErr(viper.BindPFlag("repo", rootCmd.PersistentFlags().Lookup("repo")))
+	cobra.CheckErr(viper.BindPFlag("exclude", rootCmd.PersistentFlags().Lookup("exclude")))
+	cobra.CheckErr(viper.BindPFlag("topic", rootCmd.PersistentFlags().Lookup("topic")))
+	cobra.CheckErr(viper.BindPFlag("team-owned-by", rootCmd.PersistentFlags().Lookup("team-owned-by")))
+	cobra.CheckErr(viper.BindPFlag("repos-file", rootCmd.PersistentFlags().Lookup("repos-file")))
+	cobra.CheckErr(viper.BindPFlag("visibility", rootCmd.PersistentFlags().Lookup("visibility")))
+	cobra.CheckErr(viper.BindPFlag("force-include", rootCmd.PersistentFlags().Lookup("force-include")))
+	cobra.CheckErr(viper.BindPFlag("defaults-repo", rootCmd.PersistentFlags().Lookup("defaults-repo")))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+// validateCmd checks the config and templates for problems
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the config file and templates",
+	Long: `Loads the config file and checks that group members exist, every file references
+a template that exists and parses, there are no duplicate names or paths, and that no
+two files manage the same path. Exits non-zero if any problems are found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig(viper.GetString("config"), viper.GetStringSlice("config-overlay")...)
+		if err != nil {
+			fatalf("error loading config: %s\n", err.Error())
+		}
+
+		partials, err := repo.LoadPartials(viper.GetString("partials"))
+		if err != nil {
+			fatalf("error loading partials: %s\n", err.Error())
+		}
+
+		failed := false
+		if err := cfg.Validate(); err != nil {
+			failed = true
+			fmt.Printf("%s:\n%s\n", viper.GetString("config"), err.Error())
+		}
+		if err := repo.ValidatePropertyMappings(cfg.PropertyMappings); err != nil {
+			failed = true
+			fmt.Printf("%s:\n%s\n", viper.GetString("config"), err.Error())
+		}
+		if err := repo.ValidateTemplates(cfg, viper.GetString("templates"), partials); err != nil {
+			failed = true
+			fmt.Printf("%s:\n%s\n", viper.GetString("templates"), err.Error())
+		}
+
+		if failed {
+			exit(1)
+		}
+		fmt.Println("Config and templates are valid")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
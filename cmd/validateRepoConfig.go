@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+// validateRepoConfigCmd checks a .repo-content-updater.yaml file in a local checkout
+var validateRepoConfigCmd = &cobra.Command{
+	Use:   "validate-repo-config [path]",
+	Short: "Validates the .repo-content-updater.yaml file in a local checkout",
+	Long: `Strictly parses the .repo-content-updater.yaml (or .yml) file in the given checkout,
+defaulting to the current directory. Unknown keys, such as typos, are reported as errors
+along with any patch files that do not exist. Exits non-zero if any problems are found.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repoPath := "."
+		if len(args) > 0 {
+			repoPath = args[0]
+		}
+
+		configPath := repo.RepoConfigPath(repoPath)
+		if _, err := os.Stat(configPath); err != nil {
+			fatalf("error reading repo config: %s\n", err.Error())
+		}
+
+		repoConfig, err := repo.LoadRepoConfig(repoPath)
+		if err == nil {
+			err = repoConfig.Validate(repoPath)
+		}
+		if err != nil {
+			fmt.Printf("%s:\n%s\n", configPath, err.Error())
+			exit(1)
+		}
+
+		fmt.Printf("%s is valid\n", configPath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateRepoConfigCmd)
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	// BranchKindManagedFiles is the kind of branch opened by managed-files
+	BranchKindManagedFiles = "managed-files"
+
+	// BranchKindLicense is the kind of branch opened by license
+	BranchKindLicense = "license"
+
+	// BranchKindHeaders is the kind of branch opened by headers
+	BranchKindHeaders = "headers"
+
+	// BranchKindSync is the kind of branch opened by sync
+	BranchKindSync = "sync"
+)
+
+// defaultBranches are the branch names for each kind when no branch_template is set
+var defaultBranches = map[string]string{
+	BranchKindManagedFiles: "managed-files",
+	BranchKindLicense:      "update-license",
+	BranchKindHeaders:      "update-headers",
+	BranchKindSync:         "repo-content-updater",
+}
+
+// BranchData is the data available to the branch_template
+type BranchData struct {
+	// Kind is managed-files, license, headers or sync
+	Kind string
+
+	// Group is the group of files in the PR when PRs are split per group
+	Group string
+
+	// File is the file in the PR when PRs are split per file
+	File string
+}
+
+// BranchName returns the branch for a PR. Without a branch_template, the default branch for the kind
+// is used, with the group or file appended when PRs are split, such as managed-files-base. Empty path
+// segments left by unset values are removed, so rcu/{{.Kind}}/{{.Group}} renders as rcu/license.
+func (c *Config) BranchName(data BranchData) (string, error) {
+	if c.BranchTemplate == "" {
+		name := defaultBranches[data.Kind]
+		for _, suffix := range []string{data.Group, data.File} {
+			if suffix != "" {
+				name = fmt.Sprintf("%s-%s", name, suffix)
+			}
+		}
+		return name, nil
+	}
+
+	tmpl, err := template.New("branch").Option("missingkey=error").Parse(c.BranchTemplate)
+	if err != nil {
+		return "", fmt.Errorf("error parsing branch_template: %w", err)
+	}
+	var rendered bytes.Buffer
+	if err = tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("error rendering branch_template: %w", err)
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimSpace(rendered.String()), "/") {
+		if segment = strings.Trim(segment, "-"); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("branch_template rendered an empty branch name for %s", data.Kind)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// branchPlaceholder stands in for the group or file when matching branch names
+const branchPlaceholder = "{name}"
+
+// IsBranchName returns true if BranchName could return the branch for any kind, group or file
+func (c *Config) IsBranchName(branch string) bool {
+	for _, kind := range []string{BranchKindManagedFiles, BranchKindLicense, BranchKindHeaders, BranchKindSync} {
+		for _, data := range []BranchData{{Kind: kind}, {Kind: kind, Group: branchPlaceholder}, {Kind: kind, File: branchPlaceholder}} {
+			name, err := c.BranchName(data)
+			if err != nil {
+				continue
+			}
+			prefix, suffix, split := strings.Cut(name, branchPlaceholder)
+			if !split && name == branch {
+				return true
+			}
+			if split && len(branch) > len(prefix)+len(suffix) && strings.HasPrefix(branch, prefix) && strings.HasSuffix(branch, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateBranchTemplate checks that the branch_template renders, and gives every kind, group and
+// file its own branch
+func (c *Config) validateBranchTemplate() []error {
+	if c.BranchTemplate == "" {
+		return nil
+	}
+
+	var errs []error
+	seen := map[string]string{}
+	for _, data := range []BranchData{
+		{Kind: BranchKindManagedFiles},
+		{Kind: BranchKindLicense},
+		{Kind: BranchKindHeaders},
+		{Kind: BranchKindSync},
+		{Kind: BranchKindManagedFiles, Group: "group-a"},
+		{Kind: BranchKindManagedFiles, Group: "group-b"},
+		{Kind: BranchKindManagedFiles, File: "file-a"},
+		{Kind: BranchKindManagedFiles, File: "file-b"},
+	} {
+		name, err := c.BranchName(data)
+		if err != nil {
+			return []error{err}
+		}
+		if strings.ContainsAny(name, " ~^:?*[\\") || strings.Contains(name, "..") {
+			errs = append(errs, fmt.Errorf("branch_template renders %q, which is not a valid branch name", name))
+		}
+		description := fmt.Sprintf("%+v", data)
+		if other, ok := seen[name]; ok {
+			errs = append(errs, fmt.Errorf("branch_template renders %q for both %s and %s, it must use .Kind, .Group and .File", name, other, description))
+		}
+		seen[name] = description
+	}
+
+	return errs
+}
@@ -1,23 +1,144 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config is the supported files config
 type Config struct {
+	Includes  []string          `yaml:"includes"`
 	Groups    []Group           `yaml:"groups"`
 	Files     []File            `yaml:"files"`
 	Variables map[string]string `yaml:"variables"`
+
+	// PropertyMappings sets repo config keys or template variables from custom properties
+	PropertyMappings []PropertyMapping `yaml:"property_mappings"`
+
+	// PropertyPrecedence decides whether values from custom properties (property) or from the
+	// repo's own .repo-content-updater.yaml (repo) win when both set the same value. Defaults to repo.
+	PropertyPrecedence string `yaml:"property_precedence"`
+
+	// Properties overrides the names and value semantics of the custom properties this tool reads
+	Properties Properties `yaml:"properties"`
+
+	// DefaultLicense is the license identifier applied when the manage-license property is truthy.
+	// Defaults to apache-2.0.
+	DefaultLicense string `yaml:"default_license"`
+
+	// Headers configures the license header added to source files by the headers command
+	Headers Headers `yaml:"headers"`
+
+	// YearMode decides how changes to only the years in a file are handled, for every file that does
+	// not set its own year_mode. Defaults to current.
+	YearMode string `yaml:"year_mode"`
+
+	// PrStrategy decides how changed files are split into PRs, for repos that do not set their own
+	// pr_strategy. Defaults to single.
+	PrStrategy string `yaml:"pr_strategy"`
+
+	// BranchTemplate is a text/template for the names of branches the tool pushes, such as
+	// rcu/{{.Kind}}/{{.Group}}. Defaults to the existing names, such as managed-files.
+	BranchTemplate string `yaml:"branch_template"`
+
+	// HumanCommits decides what happens when a branch the tool pushed to has commits from someone
+	// else, for repos that do not set their own human_commits. Defaults to skip.
+	HumanCommits string `yaml:"human_commits"`
+}
+
+const (
+	// PrStrategySingle opens one PR with every changed file
+	PrStrategySingle = "single"
+
+	// PrStrategyPerGroup opens a PR for each group in the managed files list, and one PR for files listed directly
+	PrStrategyPerGroup = "per-group"
+
+	// PrStrategyPerFile opens a PR for each changed file
+	PrStrategyPerFile = "per-file"
+)
+
+// ValidatePrStrategy returns an error if the strategy is not empty or one of the known strategies
+func ValidatePrStrategy(strategy string) error {
+	switch strategy {
+	case "", PrStrategySingle, PrStrategyPerGroup, PrStrategyPerFile:
+		return nil
+	}
+	return fmt.Errorf("pr_strategy must be %q, %q or %q, got %q", PrStrategySingle, PrStrategyPerGroup, PrStrategyPerFile, strategy)
+}
+
+const (
+	// HumanCommitsSkip leaves a branch with commits from someone else alone, and comments on its PR instead
+	HumanCommitsSkip = "skip"
+
+	// HumanCommitsRebase makes the changes from the target branch and applies the commits from someone else on top,
+	// skipping the branch if they conflict
+	HumanCommitsRebase = "rebase"
+)
+
+// ValidateHumanCommits returns an error if the mode is not empty, skip or rebase
+func ValidateHumanCommits(mode string) error {
+	switch mode {
+	case "", HumanCommitsSkip, HumanCommitsRebase:
+		return nil
+	}
+	return fmt.Errorf("human_commits must be %q or %q, got %q", HumanCommitsSkip, HumanCommitsRebase, mode)
+}
+
+const (
+	// YearModeCurrent always writes the rendered years, so files are updated when the year changes
+	YearModeCurrent = "current"
+
+	// YearModePreserve keeps the years already in a file unless other content in the file changed
+	YearModePreserve = "preserve"
+)
+
+const (
+	// PropertyPrecedenceRepo gives the repo's own config file precedence over custom properties
+	PropertyPrecedenceRepo = "repo"
+
+	// PropertyPrecedenceProperty gives custom properties precedence over the repo's own config file
+	PropertyPrecedenceProperty = "property"
+)
+
+// PropertyMapping maps a custom property to either a repo config key, such as pr_target_branch,
+// or a template variable. Exactly one of Key or Variable should be set.
+type PropertyMapping struct {
+	Property string `yaml:"property"`
+	Key      string `yaml:"key"`
+	Variable string `yaml:"variable"`
 }
 
 // Group is a defined group of template files to include at once
 type Group struct {
-	Name      string   `yaml:"name"`
-	Templates []string `yaml:"templates"`
+	Name      string    `yaml:"name"`
+	Templates []FileRef `yaml:"templates"`
+}
+
+// FileRef references a file from the files list by name, along with an optional
+// `when` condition that must be met for the file to be applied to a repo
+type FileRef struct {
+	Name string `yaml:"name"`
+	When string `yaml:"when"`
+
+	// Group is the group the file was included through in the managed files list, or empty if the
+	// file was listed directly. Nested groups report the outermost group.
+	Group string `yaml:"-"`
+}
+
+// UnmarshalYAML allows a FileRef to be written as either a plain file name or a
+// mapping with `name` and `when` keys
+func (f *FileRef) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		f.Name = value.Value
+		return nil
+	}
+
+	type plain FileRef
+	return value.Decode((*plain)(f))
 }
 
 // File a single supported file within the files list
@@ -26,34 +147,192 @@ type File struct {
 	TemplateName   string   `yaml:"template_name"`
 	RepoPath       string   `yaml:"repo_path"`
 	AlternatePaths []string `yaml:"alternate_paths"`
+	When           string   `yaml:"when"`
+	ConflictsWith  []string `yaml:"conflicts_with"`
+	Precedence     int      `yaml:"precedence"`
+
+	// Version labels the current template, and Versions maps older version labels to the
+	// template that should be used for repos pinned to that version
+	Version  string            `yaml:"version"`
+	Versions map[string]string `yaml:"versions"`
+
+	// License is the license identifier, such as apache-2.0 or mit, if this file is a license that
+	// can be selected with the manage-license property
+	License string `yaml:"license"`
+
+	// YearMode overrides the config's year_mode for this file
+	YearMode string `yaml:"year_mode"`
 }
 
-// LoadConfig loads config from the given path
-func LoadConfig(path string) (*Config, error) {
-	configBytes, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+// TemplateFor returns the template to use for the given version of the file. An empty
+// version, or the current version, returns the latest template.
+func (f *File) TemplateFor(version string) (string, error) {
+	if version == "" || version == f.Version {
+		return f.TemplateName, nil
 	}
+	if templateName, ok := f.Versions[version]; ok {
+		return templateName, nil
+	}
+
+	return "", fmt.Errorf("unknown version %q for file %s", version, f.Name)
+}
+
+// GroupPrefix is the prefix used to reference a group rather than a single file
+const GroupPrefix = "group:"
+
+// ExcludePrefix is the prefix used to exclude a file or group from the managed files
+const ExcludePrefix = "!"
 
-	config := &Config{}
+// ErrGroupCycle is returned when groups include each other in a loop
+var ErrGroupCycle = errors.New("group cycle detected")
 
-	err = yaml.Unmarshal(configBytes, config)
-	if err != nil {
-		return nil, err
+// ExpandGroup takes a group name and returns the files the group corresponds to.
+// Groups may include other groups by listing `group:<name>` as a member. Nested
+// groups are expanded recursively, and each file is only returned once.
+func (c *Config) ExpandGroup(name string) ([]FileRef, error) {
+	return c.expandGroup(name, nil)
+}
+
+func (c *Config) expandGroup(name string, parents []string) ([]FileRef, error) {
+	for _, parent := range parents {
+		if parent == name {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrGroupCycle, strings.Join(parents, " -> "), name)
+		}
+	}
+
+	group := c.getGroup(name)
+	if group == nil {
+		return nil, fmt.Errorf("unknown group: %s", name)
+	}
+	parents = append(parents, name)
+
+	var files []FileRef
+	for _, member := range group.Templates {
+		if !strings.HasPrefix(member.Name, GroupPrefix) {
+			files = append(files, member)
+			continue
+		}
+
+		nested, err := c.expandGroup(strings.TrimPrefix(member.Name, GroupPrefix), parents)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range nested {
+			ref.When = joinConditions(member.When, ref.When)
+			files = append(files, ref)
+		}
+	}
+
+	return DedupeFileRefs(files), nil
+}
+
+// ResolveFiles parses a list of file names and groups, such as the value of the managed-files
+// custom property, and returns the files it refers to. Entries are separated by the managed
+// files property separator, which defaults to a comma.
+//
+// Entries prefixed with `!` are exclusions, so `group:base,!dependabot` includes every
+// file in the base group except dependabot. Exclusions are applied after all inclusions,
+// regardless of where they appear in the list. Files keep the order they were first
+// included in and duplicates are removed.
+//
+// Unknown groups do not prevent the rest of the list from resolving. The files that
+// could be resolved are returned along with an error describing the problems.
+func (c *Config) ResolveFiles(value string) ([]FileRef, error) {
+	var included []FileRef
+	excluded := map[string]bool{}
+	var errs []error
+
+	for _, entry := range c.GetProperties().ManagedFiles.Split(value) {
+		exclude := strings.HasPrefix(entry, ExcludePrefix)
+		entry = strings.TrimSpace(strings.TrimPrefix(entry, ExcludePrefix))
+
+		var refs []FileRef
+		if strings.HasPrefix(entry, GroupPrefix) {
+			groupName := strings.TrimPrefix(entry, GroupPrefix)
+			groupFiles, err := c.ExpandGroup(groupName)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for i := range groupFiles {
+				groupFiles[i].Group = groupName
+			}
+			refs = groupFiles
+		} else {
+			refs = []FileRef{{Name: entry}}
+		}
+
+		if exclude {
+			for _, ref := range refs {
+				excluded[ref.Name] = true
+			}
+		} else {
+			included = append(included, refs...)
+		}
+	}
+
+	var files []FileRef
+	for _, ref := range DedupeFileRefs(included) {
+		if !excluded[ref.Name] {
+			files = append(files, ref)
+		}
 	}
 
-	return config, nil
+	return files, errors.Join(errs...)
 }
 
-// ExpandGroup takes a group name and returns the files the group corresponds to
-func (c *Config) ExpandGroup(name string) ([]string, error) {
+func (c *Config) getGroup(name string) *Group {
 	for _, group := range c.Groups {
 		if group.Name == name {
-			return group.Templates, nil
+			return &group
 		}
 	}
 
-	return nil, fmt.Errorf("unknown group: %s", name)
+	return nil
+}
+
+// DedupeFileRefs removes repeated references to the same file, keeping the position and group of
+// the first one. The file is included if any of the references' `when` conditions are met, so a file
+// also listed without a condition is always included.
+func DedupeFileRefs(refs []FileRef) []FileRef {
+	index := map[string]int{}
+	var result []FileRef
+	for _, ref := range refs {
+		i, ok := index[ref.Name]
+		if !ok {
+			index[ref.Name] = len(result)
+			result = append(result, ref)
+			continue
+		}
+		result[i].When = eitherCondition(result[i].When, ref.When)
+	}
+
+	return result
+}
+
+// eitherCondition combines two `when` conditions so either may be met. An empty condition is
+// always met.
+func eitherCondition(a, b string) string {
+	if a == "" || b == "" {
+		return ""
+	}
+	if a == b {
+		return a
+	}
+
+	return fmt.Sprintf("or (%s) (%s)", a, b)
+}
+
+// joinConditions combines two `when` conditions so both must be met
+func joinConditions(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+
+	return fmt.Sprintf("and (%s) (%s)", a, b)
 }
 
 // GetFileInfo returns settings for a single file
@@ -66,3 +345,315 @@ func (c *Config) GetFileInfo(name string) *File {
 
 	return nil
 }
+
+// Validate checks the config for problems that would otherwise only show up while
+// processing repos, such as groups referencing files that do not exist. All problems
+// found are returned together as a single error.
+func (c *Config) Validate() error {
+	var errs []error
+
+	fileNames := map[string]bool{}
+	for _, file := range c.Files {
+		if file.Name == "" {
+			errs = append(errs, fmt.Errorf("file with template_name %q has no name", file.TemplateName))
+			continue
+		}
+		if fileNames[file.Name] {
+			errs = append(errs, fmt.Errorf("file %q is defined more than once", file.Name))
+		}
+		fileNames[file.Name] = true
+
+		if file.TemplateName == "" {
+			errs = append(errs, fmt.Errorf("file %q has no template_name", file.Name))
+		}
+		if file.RepoPath == "" {
+			errs = append(errs, fmt.Errorf("file %q has no repo_path", file.Name))
+		}
+
+		if len(file.Versions) > 0 && file.Version == "" {
+			errs = append(errs, fmt.Errorf("file %q lists versions but has no version for the current template", file.Name))
+		}
+		if _, ok := file.Versions[file.Version]; ok && file.Version != "" {
+			errs = append(errs, fmt.Errorf("file %q lists its current version %q under versions", file.Name, file.Version))
+		}
+
+		seenPaths := map[string]bool{file.RepoPath: true}
+		for _, alternate := range file.AlternatePaths {
+			if seenPaths[alternate] {
+				errs = append(errs, fmt.Errorf("file %q lists %s more than once in repo_path and alternate_paths", file.Name, alternate))
+			}
+			seenPaths[alternate] = true
+		}
+	}
+
+	groupNames := map[string]bool{}
+	for _, group := range c.Groups {
+		if groupNames[group.Name] {
+			errs = append(errs, fmt.Errorf("group %q is defined more than once", group.Name))
+		}
+		groupNames[group.Name] = true
+	}
+
+	for _, group := range c.Groups {
+		for _, member := range group.Templates {
+			if strings.HasPrefix(member.Name, GroupPrefix) {
+				if !groupNames[strings.TrimPrefix(member.Name, GroupPrefix)] {
+					errs = append(errs, fmt.Errorf("group %q references unknown group %q", group.Name, member.Name))
+				}
+				continue
+			}
+			if !fileNames[member.Name] {
+				errs = append(errs, fmt.Errorf("group %q references unknown file %q", group.Name, member.Name))
+			}
+		}
+
+		if _, err := c.ExpandGroup(group.Name); errors.Is(err, ErrGroupCycle) {
+			errs = append(errs, fmt.Errorf("group %q: %w", group.Name, err))
+		}
+	}
+
+	errs = append(errs, c.pathCollisions()...)
+
+	licenses := map[string]string{}
+	for _, file := range c.Files {
+		if file.License == "" {
+			continue
+		}
+		license := strings.ToLower(file.License)
+		if other, ok := licenses[license]; ok {
+			errs = append(errs, fmt.Errorf("files %q and %q are both the %s license", other, file.Name, file.License))
+		}
+		licenses[license] = file.Name
+	}
+	if c.DefaultLicense != "" && c.LicenseFile(c.DefaultLicense) == nil {
+		errs = append(errs, fmt.Errorf("default_license %q has no file with that license", c.DefaultLicense))
+	}
+
+	errs = append(errs, c.GetHeaders().validate()...)
+
+	if err := ValidatePrStrategy(c.PrStrategy); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.validateBranchTemplate()...)
+	if err := ValidateHumanCommits(c.HumanCommits); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, validateYearMode("year_mode", c.YearMode)...)
+	errs = append(errs, validateYearMode("headers: year_mode", c.Headers.YearMode)...)
+	for _, file := range c.Files {
+		errs = append(errs, validateYearMode(fmt.Sprintf("file %q: year_mode", file.Name), file.YearMode)...)
+	}
+
+	switch c.PropertyPrecedence {
+	case "", PropertyPrecedenceRepo, PropertyPrecedenceProperty:
+	default:
+		errs = append(errs, fmt.Errorf("property_precedence must be %q or %q, got %q", PropertyPrecedenceRepo, PropertyPrecedenceProperty, c.PropertyPrecedence))
+	}
+
+	properties := c.GetProperties()
+	propertyNames := map[string]string{}
+	for _, setting := range []struct {
+		name     string
+		property Property
+	}{
+		{"managed_files", properties.ManagedFiles},
+		{"manage_license", properties.ManageLicense},
+		{"bypass_pr", properties.BypassPR},
+		{"pin_versions", properties.PinVersions},
+		{"manage_headers", properties.ManageHeaders},
+	} {
+		if other, ok := propertyNames[setting.property.Name]; ok {
+			errs = append(errs, fmt.Errorf("properties %s and %s both use the custom property %q", other, setting.name, setting.property.Name))
+		}
+		propertyNames[setting.property.Name] = setting.name
+	}
+
+	mappedProperties := map[string]bool{}
+	for _, mapping := range c.PropertyMappings {
+		if mapping.Property == "" {
+			errs = append(errs, errors.New("property mapping has no property"))
+			continue
+		}
+		if mappedProperties[mapping.Property] {
+			errs = append(errs, fmt.Errorf("property %q is mapped more than once", mapping.Property))
+		}
+		mappedProperties[mapping.Property] = true
+		if (mapping.Key == "") == (mapping.Variable == "") {
+			errs = append(errs, fmt.Errorf("property mapping for %q must set exactly one of key or variable", mapping.Property))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// YearModeFor returns the year mode for the file, falling back to the config's year_mode
+func (c *Config) YearModeFor(file *File) string {
+	if file.YearMode != "" {
+		return file.YearMode
+	}
+	if c.YearMode != "" {
+		return c.YearMode
+	}
+	return YearModeCurrent
+}
+
+func validateYearMode(name, mode string) []error {
+	switch mode {
+	case "", YearModeCurrent, YearModePreserve:
+		return nil
+	}
+	return []error{fmt.Errorf("%s must be %q or %q, got %q", name, YearModeCurrent, YearModePreserve, mode)}
+}
+
+// pathCollisions returns an error for every pair of files that manage the same path without
+// a conflicts_with or precedence rule to decide between them. Any file can be listed in a repo's
+// managed files, so every pair could end up applied to the same repo. License files are the
+// exception, since a repo only selects one license.
+func (c *Config) pathCollisions() []error {
+	var errs []error
+	for i, a := range c.Files {
+		for _, b := range c.Files[i+1:] {
+			if a.License != "" && b.License != "" {
+				continue
+			}
+			if err := collision(a, b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// Superseded is a file that was dropped from a repo because another file manages the same path
+type Superseded struct {
+	Name string
+	By   string
+}
+
+// ResolveCollisions finds files that would write to the same path in a repo, and drops the
+// losing files based on the conflicts_with and precedence rules. The files managing a path are
+// resolved together: a file is kept once every file that beats it has been dropped, and dropped
+// once a kept file beats it, so a file that already lost does not knock out any others. If two
+// kept files have no rule to decide between them, an error describing every such pair is returned.
+// References to files that are not in the config are passed through unchanged.
+func (c *Config) ResolveCollisions(refs []FileRef) ([]FileRef, []Superseded, error) {
+	var files []File
+	for _, ref := range refs {
+		if file := c.GetFileInfo(ref.Name); file != nil {
+			files = append(files, *file)
+		}
+	}
+
+	kept := map[string]bool{}
+	dropped := map[string]string{}
+	for changed := true; changed; {
+		changed = false
+		for _, file := range files {
+			if kept[file.Name] || dropped[file.Name] != "" {
+				continue
+			}
+			undecided := false
+			for _, other := range files {
+				if other.Name == file.Name || dropped[other.Name] != "" || len(collidingPaths(file, other)) == 0 {
+					continue
+				}
+				if _, loser, ok := collisionWinner(file, other); !ok || loser != file.Name {
+					continue
+				}
+				if kept[other.Name] {
+					dropped[file.Name] = other.Name
+					break
+				}
+				undecided = true
+			}
+			if dropped[file.Name] == "" && !undecided {
+				kept[file.Name] = true
+			}
+			changed = changed || kept[file.Name] || dropped[file.Name] != ""
+		}
+	}
+
+	var errs []error
+	for i, a := range files {
+		if dropped[a.Name] != "" {
+			continue
+		}
+		if !kept[a.Name] {
+			errs = append(errs, fmt.Errorf("file %q is in a loop of conflicts_with and precedence rules", a.Name))
+			continue
+		}
+		for _, b := range files[i+1:] {
+			if kept[b.Name] {
+				if err := collision(a, b); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	var result []FileRef
+	var superseded []Superseded
+	for _, ref := range refs {
+		if by, ok := dropped[ref.Name]; ok {
+			superseded = append(superseded, Superseded{Name: ref.Name, By: by})
+			continue
+		}
+		result = append(result, ref)
+	}
+
+	return result, superseded, nil
+}
+
+// collision returns an error if both files manage the same path and no rule decides which wins
+func collision(a, b File) error {
+	shared := collidingPaths(a, b)
+	if len(shared) == 0 {
+		return nil
+	}
+	if _, _, ok := collisionWinner(a, b); ok {
+		return nil
+	}
+
+	return fmt.Errorf("files %q and %q both manage %s with no conflicts_with or precedence rule between them", a.Name, b.Name, strings.Join(shared, ", "))
+}
+
+// collisionWinner decides which of two colliding files should be applied. A file that lists the
+// other in conflicts_with wins, otherwise the file with the higher precedence wins.
+func collisionWinner(a, b File) (string, string, bool) {
+	aReplacesB := slices.Contains(a.ConflictsWith, b.Name)
+	bReplacesA := slices.Contains(b.ConflictsWith, a.Name)
+	switch {
+	case aReplacesB && !bReplacesA:
+		return a.Name, b.Name, true
+	case bReplacesA && !aReplacesB:
+		return b.Name, a.Name, true
+	case a.Precedence > b.Precedence:
+		return a.Name, b.Name, true
+	case b.Precedence > a.Precedence:
+		return b.Name, a.Name, true
+	}
+
+	return "", "", false
+}
+
+// collidingPaths returns the paths where applying one file would overwrite or remove what the
+// other file writes. Sharing an alternate path is not a collision, since both files only remove it.
+func collidingPaths(a, b File) []string {
+	var shared []string
+	if a.RepoPath == b.RepoPath {
+		shared = append(shared, a.RepoPath)
+	}
+	if slices.Contains(b.AlternatePaths, a.RepoPath) {
+		shared = append(shared, a.RepoPath)
+	}
+	if b.RepoPath != a.RepoPath && slices.Contains(a.AlternatePaths, b.RepoPath) {
+		shared = append(shared, b.RepoPath)
+	}
+
+	return shared
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 
 	"github.com/chia-network/repo-content-updater/internal/config"
 )
@@ -11,10 +12,394 @@ import (
 func TestConfigIsValid(t *testing.T) {
 	cfg, err := config.LoadConfig("../../config.yaml")
 	assert.Nil(t, err)
+	assert.Nil(t, cfg.Validate())
 
 	for _, group := range cfg.Groups {
 		files, err := cfg.ExpandGroup(group.Name)
 		assert.Nil(t, err)
-		assert.Equal(t, len(group.Templates), len(files))
+		assert.NotEmpty(t, files)
 	}
 }
+
+func TestGroupMembersWithConditions(t *testing.T) {
+	cfg := &config.Config{}
+	err := yaml.Unmarshal([]byte(`
+groups:
+  - name: go
+    templates:
+      - go-makefile
+      - name: go-dependabot
+        when: exists "go.mod"
+`), cfg)
+	assert.Nil(t, err)
+
+	files, err := cfg.ExpandGroup("go")
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{
+		{Name: "go-makefile"},
+		{Name: "go-dependabot", When: `exists "go.mod"`},
+	}, files)
+}
+
+func TestNestedGroupsAndExclusions(t *testing.T) {
+	cfg := &config.Config{}
+	err := yaml.Unmarshal([]byte(`
+groups:
+  - name: base
+    templates:
+      - dep-review
+      - dependabot
+  - name: go
+    templates:
+      - group:base
+      - go-makefile
+      - name: group:go-ci
+        when: exists "go.mod"
+  - name: go-ci
+    templates:
+      - go-test
+      - dependabot
+  - name: loop-a
+    templates:
+      - group:loop-b
+  - name: loop-b
+    templates:
+      - group:loop-a
+`), cfg)
+	assert.Nil(t, err)
+
+	files, err := cfg.ExpandGroup("go")
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{
+		{Name: "dep-review"},
+		{Name: "dependabot"},
+		{Name: "go-makefile"},
+		{Name: "go-test", When: `exists "go.mod"`},
+	}, files)
+
+	_, err = cfg.ExpandGroup("loop-a")
+	assert.ErrorContains(t, err, "group cycle detected: loop-a -> loop-b -> loop-a")
+
+	files, err = cfg.ResolveFiles("!dependabot, group:go, prettier, go-makefile, !group:go-ci")
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{
+		{Name: "dep-review", Group: "go"},
+		{Name: "go-makefile", Group: "go"},
+		{Name: "prettier"},
+	}, files)
+
+	// Unknown groups are reported but do not prevent the rest of the list resolving
+	files, err = cfg.ResolveFiles("group:missing,prettier")
+	assert.ErrorContains(t, err, "unknown group: missing")
+	assert.Equal(t, []config.FileRef{{Name: "prettier"}}, files)
+}
+
+func TestDuplicateFilesWithConditions(t *testing.T) {
+	cfg := &config.Config{}
+	err := yaml.Unmarshal([]byte(`
+groups:
+  - name: go-ci
+    templates:
+      - name: go-test
+        when: exists "go.mod"
+      - name: go-lint
+        when: exists "go.mod"
+  - name: ci
+    templates:
+      - group:go-ci
+      - name: go-lint
+        when: exists "Makefile"
+`), cfg)
+	assert.Nil(t, err)
+
+	// A file listed directly without a condition is always included, even if a group also
+	// includes it with one
+	files, err := cfg.ResolveFiles("group:go-ci,go-test")
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{
+		{Name: "go-test", Group: "go-ci"},
+		{Name: "go-lint", When: `exists "go.mod"`, Group: "go-ci"},
+	}, files)
+
+	// Otherwise the file is included if either condition is met
+	files, err = cfg.ExpandGroup("ci")
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{
+		{Name: "go-test", When: `exists "go.mod"`},
+		{Name: "go-lint", When: `or (exists "go.mod") (exists "Makefile")`},
+	}, files)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &config.Config{}
+	err := yaml.Unmarshal([]byte(`
+groups:
+  - name: base
+    templates:
+      - dep-review
+      - missing-file
+      - group:missing-group
+  - name: base
+    templates:
+      - dep-review
+files:
+  - name: dep-review
+    template_name: dependency-review.yml
+    repo_path: .github/workflows/dependency-review.yml
+    alternate_paths:
+      - .github/workflows/dependency-review.yaml
+      - .github/workflows/dependency-review.yaml
+  - name: dependabot
+    template_name: dependabot.yml
+    repo_path: .github/dependabot.yml
+  - name: go-dependabot
+    template_name: go-dependabot.yml
+    repo_path: .github/dependabot.yml
+  - name: dependabot
+    template_name: dependabot.yml
+    repo_path: .github/other.yml
+`), cfg)
+	assert.Nil(t, err)
+
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, `file "dependabot" is defined more than once`)
+	assert.ErrorContains(t, err, `group "base" is defined more than once`)
+	assert.ErrorContains(t, err, `group "base" references unknown file "missing-file"`)
+	assert.ErrorContains(t, err, `group "base" references unknown group "group:missing-group"`)
+	assert.ErrorContains(t, err, `file "dep-review" lists .github/workflows/dependency-review.yaml more than once`)
+	assert.ErrorContains(t, err, `files "dependabot" and "go-dependabot" both manage .github/dependabot.yml with no conflicts_with or precedence rule between them`)
+}
+
+func TestResolveCollisions(t *testing.T) {
+	cfg := &config.Config{}
+	err := yaml.Unmarshal([]byte(`
+files:
+  - name: dependabot
+    repo_path: .github/dependabot.yml
+  - name: go-dependabot
+    repo_path: .github/dependabot.yml
+    conflicts_with:
+      - dependabot
+  - name: prettier
+    repo_path: .prettierrc.yml
+  - name: prettier-json
+    repo_path: .prettierrc.json
+    alternate_paths:
+      - .prettierrc.yml
+    precedence: 1
+  - name: renovate
+    repo_path: renovate.json
+  - name: renovate-ips
+    repo_path: renovate.json
+`), cfg)
+	assert.Nil(t, err)
+
+	kept, superseded, err := cfg.ResolveCollisions([]config.FileRef{
+		{Name: "dependabot"},
+		{Name: "prettier"},
+		{Name: "go-dependabot"},
+		{Name: "prettier-json"},
+		{Name: "unknown"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{{Name: "go-dependabot"}, {Name: "prettier-json"}, {Name: "unknown"}}, kept)
+	assert.Equal(t, []config.Superseded{
+		{Name: "dependabot", By: "go-dependabot"},
+		{Name: "prettier", By: "prettier-json"},
+	}, superseded)
+
+	_, _, err = cfg.ResolveCollisions([]config.FileRef{{Name: "renovate"}, {Name: "renovate-ips"}})
+	assert.ErrorContains(t, err, `files "renovate" and "renovate-ips" both manage renovate.json`)
+}
+
+func TestResolveCollisionsSkipsFilesThatLost(t *testing.T) {
+	cfg := &config.Config{}
+	err := yaml.Unmarshal([]byte(`
+files:
+  - name: workflow-v2
+    repo_path: .github/workflows/build.yml
+    precedence: 2
+  - name: workflow-v1
+    repo_path: .github/workflows/build.yml
+    alternate_paths:
+      - .github/workflows/build.yaml
+      - .github/workflows/ci.yml
+    precedence: 1
+  - name: workflow-yaml
+    repo_path: .github/workflows/build.yaml
+  - name: ci
+    repo_path: .github/workflows/ci.yml
+    precedence: 1
+`), cfg)
+	assert.Nil(t, err)
+
+	// workflow-v1 loses to workflow-v2, so it neither knocks out workflow-yaml nor needs a rule
+	// against ci
+	kept, superseded, err := cfg.ResolveCollisions([]config.FileRef{
+		{Name: "workflow-v1"},
+		{Name: "workflow-yaml"},
+		{Name: "ci"},
+		{Name: "workflow-v2"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{{Name: "workflow-yaml"}, {Name: "ci"}, {Name: "workflow-v2"}}, kept)
+	assert.Equal(t, []config.Superseded{{Name: "workflow-v1", By: "workflow-v2"}}, superseded)
+}
+
+func TestTemplateFor(t *testing.T) {
+	file := config.File{
+		Name:         "go-test",
+		TemplateName: "go-test.yml",
+		Version:      "2",
+		Versions: map[string]string{
+			"1": "go-test.v1.yml",
+		},
+	}
+
+	for version, expected := range map[string]string{"": "go-test.yml", "2": "go-test.yml", "1": "go-test.v1.yml"} {
+		templateName, err := file.TemplateFor(version)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, templateName)
+	}
+
+	_, err := file.TemplateFor("3")
+	assert.ErrorContains(t, err, `unknown version "3" for file go-test`)
+}
+
+func TestCustomPropertySettings(t *testing.T) {
+	cfg := &config.Config{}
+	properties := cfg.GetProperties()
+	assert.Equal(t, "managed-files", properties.ManagedFiles.Name)
+	assert.True(t, properties.ManageLicense.IsTruthy("yes"))
+	assert.False(t, properties.ManageLicense.IsTruthy("no"))
+	assert.True(t, properties.BypassPR.IsTruthy("true"))
+
+	err := yaml.Unmarshal([]byte(`
+groups:
+  - name: base
+    templates:
+      - dep-review
+      - dependabot
+properties:
+  managed_files:
+    name: security-managed-files
+    separator: ";"
+  bypass_pr:
+    name: security-bypass-pr
+    truthy: ["true", "1"]
+`), cfg)
+	assert.Nil(t, err)
+
+	properties = cfg.GetProperties()
+	assert.Equal(t, "security-managed-files", properties.ManagedFiles.Name)
+	assert.Equal(t, "manage-license", properties.ManageLicense.Name)
+	assert.True(t, properties.BypassPR.IsTruthy("1"))
+	assert.True(t, properties.BypassPR.IsTruthy("TRUE"))
+
+	files, err := cfg.ResolveFiles("group:base; !dependabot; prettier")
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{{Name: "dep-review", Group: "base"}, {Name: "prettier"}}, files)
+}
+
+func TestResolveLicense(t *testing.T) {
+	cfg := &config.Config{}
+	err := yaml.Unmarshal([]byte(`
+files:
+  - name: license-apache-2.0
+    license: apache-2.0
+    template_name: LICENSE
+    repo_path: LICENSE
+  - name: license-mit
+    license: mit
+    template_name: LICENSE-MIT
+    repo_path: LICENSE
+    alternate_paths:
+      - LICENSE-MIT
+`), cfg)
+	assert.Nil(t, err)
+	assert.Nil(t, cfg.Validate())
+
+	assert.Equal(t, "license-apache-2.0", cfg.ResolveLicense("yes").Name)
+	assert.Equal(t, "license-apache-2.0", cfg.ResolveLicense("Apache-2.0").Name)
+	assert.Equal(t, "license-mit", cfg.ResolveLicense("mit").Name)
+	assert.Nil(t, cfg.ResolveLicense("no"))
+	assert.Nil(t, cfg.ResolveLicense("gpl-3.0"))
+
+	cfg.DefaultLicense = "mit"
+	assert.Equal(t, "license-mit", cfg.ResolveLicense("yes").Name)
+
+	cfg.DefaultLicense = "bsd-3-clause"
+	assert.ErrorContains(t, cfg.Validate(), `default_license "bsd-3-clause" has no file with that license`)
+}
+
+func TestHeaders(t *testing.T) {
+	headers := (&config.Config{}).GetHeaders()
+	assert.True(t, headers.Matches("main.go"))
+	assert.True(t, headers.Matches("internal/repo/headers.go"))
+	assert.True(t, headers.Matches("scripts/build.py"))
+	assert.False(t, headers.Matches("vendor/github.com/pkg/errors/errors.go"))
+	assert.False(t, headers.Matches("api/service.pb.go"))
+	assert.False(t, headers.Matches("readme.md"))
+
+	for pattern, matches := range map[string]map[string]bool{
+		"**/*.go":      {"main.go": true, "a/b/c.go": true, "a/b/c.py": false},
+		"cmd/**":       {"cmd/root.go": true, "cmd/sub/x.go": true, "internal/cmd/x.go": false},
+		"src/**/gen/*": {"src/gen/a.ts": true, "src/x/y/gen/a.ts": true, "src/x/a.ts": false},
+	} {
+		for name, expected := range matches {
+			matched, err := config.MatchGlob(pattern, name)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, matched, "%s %s", pattern, name)
+		}
+	}
+
+	cfg := &config.Config{Headers: config.Headers{Include: []string{"src/[*.go"}, Comments: map[string]string{"go": "//"}}}
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, `headers: invalid glob "src/[*.go"`)
+	assert.ErrorContains(t, err, `headers: comment extension "go" must start with a dot`)
+}
+
+func TestBranchName(t *testing.T) {
+	cfg := &config.Config{}
+	name, err := cfg.BranchName(config.BranchData{Kind: config.BranchKindLicense})
+	assert.Nil(t, err)
+	assert.Equal(t, "update-license", name)
+	name, err = cfg.BranchName(config.BranchData{Kind: config.BranchKindManagedFiles, Group: "base"})
+	assert.Nil(t, err)
+	assert.Equal(t, "managed-files-base", name)
+
+	cfg.BranchTemplate = "rcu/{{.Kind}}/{{.Group}}{{.File}}"
+	name, err = cfg.BranchName(config.BranchData{Kind: config.BranchKindManagedFiles, Group: "base"})
+	assert.Nil(t, err)
+	assert.Equal(t, "rcu/managed-files/base", name)
+	name, err = cfg.BranchName(config.BranchData{Kind: config.BranchKindHeaders})
+	assert.Nil(t, err)
+	assert.Equal(t, "rcu/headers", name)
+	assert.Nil(t, cfg.Validate())
+
+	cfg.BranchTemplate = "rcu/{{.Kind}}"
+	assert.NotNil(t, cfg.Validate())
+}
+
+func TestIsBranchName(t *testing.T) {
+	cfg := &config.Config{}
+	assert.True(t, cfg.IsBranchName("update-license"))
+	assert.True(t, cfg.IsBranchName("managed-files-base"))
+	assert.True(t, cfg.IsBranchName("repo-content-updater"))
+	assert.False(t, cfg.IsBranchName("managed-files-"))
+	assert.False(t, cfg.IsBranchName("fix-workflow"))
+
+	cfg.BranchTemplate = "rcu/{{.Kind}}/{{.Group}}{{.File}}"
+	assert.True(t, cfg.IsBranchName("rcu/license"))
+	assert.True(t, cfg.IsBranchName("rcu/managed-files/go-test"))
+	assert.False(t, cfg.IsBranchName("update-license"))
+	assert.False(t, cfg.IsBranchName("rcu/other"))
+}
+
+func TestValidateHumanCommits(t *testing.T) {
+	assert.Nil(t, config.ValidateHumanCommits(""))
+	assert.Nil(t, config.ValidateHumanCommits(config.HumanCommitsSkip))
+	assert.Nil(t, config.ValidateHumanCommits(config.HumanCommitsRebase))
+	assert.NotNil(t, config.ValidateHumanCommits("force"))
+	assert.NotNil(t, (&config.Config{HumanCommits: "merge"}).Validate())
+}
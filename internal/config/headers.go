@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Headers configures the license header that the headers command keeps at the top of source files
+type Headers struct {
+	// TemplateName is the template in the templates folder rendered as the header text, without comment markers
+	TemplateName string `yaml:"template_name"`
+
+	// Include are glob patterns of repo paths to add headers to. ** matches any number of directories.
+	Include []string `yaml:"include"`
+
+	// Exclude are glob patterns of repo paths that never get headers, even if they match Include
+	Exclude []string `yaml:"exclude"`
+
+	// Comments maps file extensions, such as .go, to the line comment prefix used for the header
+	Comments map[string]string `yaml:"comments"`
+
+	// GeneratedMarkers are strings that mark a file as generated when found near the top of the
+	// file. Generated files never get headers.
+	GeneratedMarkers []string `yaml:"generated_markers"`
+
+	// YearMode overrides the config's year_mode for headers
+	YearMode string `yaml:"year_mode"`
+}
+
+// defaultHeaders are the header settings used when not set in the config
+var defaultHeaders = Headers{
+	Include: []string{"**/*.go", "**/*.py", "**/*.rs", "**/*.ts"},
+	Exclude: []string{"vendor/**", "node_modules/**", "**/*.pb.go", "**/*.d.ts"},
+	Comments: map[string]string{
+		".go": "//",
+		".rs": "//",
+		".ts": "//",
+		".py": "#",
+	},
+	GeneratedMarkers: []string{"Code generated", "DO NOT EDIT", "@generated", "autogenerated"},
+}
+
+// GetHeaders returns the header settings, with defaults filled in for anything not set
+func (c *Config) GetHeaders() Headers {
+	headers := c.Headers
+	if len(headers.Include) == 0 {
+		headers.Include = defaultHeaders.Include
+	}
+	if headers.Exclude == nil {
+		headers.Exclude = defaultHeaders.Exclude
+	}
+	if len(headers.Comments) == 0 {
+		headers.Comments = defaultHeaders.Comments
+	}
+	if headers.GeneratedMarkers == nil {
+		headers.GeneratedMarkers = defaultHeaders.GeneratedMarkers
+	}
+	if headers.YearMode == "" {
+		headers.YearMode = c.YearMode
+	}
+	if headers.YearMode == "" {
+		headers.YearMode = YearModeCurrent
+	}
+	return headers
+}
+
+// Matches returns true if the repo path matches an include pattern, matches no exclude pattern
+// and has comment syntax configured for its extension
+func (h Headers) Matches(repoPath string) bool {
+	if _, ok := h.Comments[path.Ext(repoPath)]; !ok {
+		return false
+	}
+	return MatchAnyGlob(h.Include, repoPath) && !MatchAnyGlob(h.Exclude, repoPath)
+}
+
+// validate checks the header globs and comment syntax
+func (h Headers) validate() []error {
+	var errs []error
+	for _, pattern := range append(append([]string{}, h.Include...), h.Exclude...) {
+		if err := ValidateGlob(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("headers: invalid glob %q: %w", pattern, err))
+		}
+	}
+	for ext, prefix := range h.Comments {
+		if !strings.HasPrefix(ext, ".") {
+			errs = append(errs, fmt.Errorf("headers: comment extension %q must start with a dot", ext))
+		}
+		if strings.TrimSpace(prefix) == "" {
+			errs = append(errs, fmt.Errorf("headers: comment prefix for %s is empty", ext))
+		}
+	}
+	return errs
+}
+
+// ValidateGlob checks every segment of the glob pattern for syntax errors
+func ValidateGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchAnyGlob returns true if the slash separated path matches any of the glob patterns
+func MatchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := MatchGlob(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether the slash separated path matches the glob pattern. Patterns use
+// path.Match syntax for each path segment, and a ** segment matches zero or more directories.
+func MatchGlob(pattern, name string) (bool, error) {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				matched, err := matchSegments(pattern[1:], name[i:])
+				if matched || err != nil {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(pattern[0], name[0])
+		if !matched || err != nil {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0, nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"strings"
+)
+
+// DefaultLicense is the license applied to repos that set the manage-license property to a truthy
+// value rather than a license identifier, when default_license is not set in the config
+const DefaultLicense = "apache-2.0"
+
+// GetDefaultLicense returns the license identifier applied when the manage-license property is truthy
+func (c *Config) GetDefaultLicense() string {
+	if c.DefaultLicense != "" {
+		return c.DefaultLicense
+	}
+	return DefaultLicense
+}
+
+// LicenseFile returns the file that manages the given license identifier, or nil if there is none.
+// Identifiers are compared case-insensitively.
+func (c *Config) LicenseFile(license string) *File {
+	for i := range c.Files {
+		if c.Files[i].License != "" && strings.EqualFold(c.Files[i].License, strings.TrimSpace(license)) {
+			return &c.Files[i]
+		}
+	}
+	return nil
+}
+
+// ResolveLicense returns the license file selected by a manage-license property value. A truthy
+// value, such as yes, selects the default license, and a license identifier, such as mit, selects
+// that license. Any other value means the license is not managed, and nil is returned.
+func (c *Config) ResolveLicense(value string) *File {
+	if c.GetProperties().ManageLicense.IsTruthy(value) {
+		return c.LicenseFile(c.GetDefaultLicense())
+	}
+	return c.LicenseFile(value)
+}
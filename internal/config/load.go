@@ -0,0 +1,269 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig loads config from the given path
+//
+// The path may be a single file or a directory such as config.d/, in which case every
+// .yaml and .yml file in the directory is loaded in name order. Any file may also list
+// other files (or globs) to load under `includes`, relative to the including file.
+// Files, groups and variables may only be defined once across all of these files.
+//
+// Overlays are loaded afterward in the order given, and replace any files, groups or
+// variables with the same name. This allows a shared base config to be adjusted for a
+// particular environment or org.
+func LoadConfig(path string, overlays ...string) (*Config, error) {
+	l := &loader{
+		config:  &Config{},
+		sources: map[string]string{},
+		loaded:  map[string]bool{},
+	}
+
+	if err := l.load(path, false); err != nil {
+		return nil, err
+	}
+
+	for _, overlay := range overlays {
+		if err := l.load(overlay, true); err != nil {
+			return nil, err
+		}
+	}
+
+	l.config.Includes = nil
+
+	// A branch_template that gives several PRs the same branch would make them overwrite each other
+	if errs := l.config.validateBranchTemplate(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return l.config, nil
+}
+
+// loader merges config from multiple files, keeping track of where each definition came from
+type loader struct {
+	config *Config
+
+	// sources maps each definition, such as "file dependabot", to the path that defined it
+	sources map[string]string
+
+	// loaded tracks paths that have already been loaded, so include loops are not followed
+	loaded map[string]bool
+}
+
+func (l *loader) load(path string, overlay bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		var paths []string
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return err
+			}
+			paths = append(paths, matches...)
+		}
+		sort.Strings(paths)
+
+		for _, p := range paths {
+			if err := l.load(p, overlay); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if l.loaded[absPath] {
+		return nil
+	}
+	l.loaded[absPath] = true
+
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	config := &Config{}
+	err = yaml.Unmarshal(configBytes, config)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	if err := l.merge(path, config, overlay); err != nil {
+		return err
+	}
+
+	for _, include := range config.Includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		matches, err := filepath.Glob(include)
+		if err != nil {
+			return fmt.Errorf("invalid include %s in %s: %w", include, path, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("include %s in %s did not match any files", include, path)
+		}
+		for _, match := range matches {
+			if err := l.load(match, overlay); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// merge adds the definitions from config into the loaded config. Unless this is an overlay,
+// defining something that was already defined by another file is an error. Repeated definitions
+// within the same file are left for Validate to report.
+func (l *loader) merge(path string, config *Config, overlay bool) error {
+	for _, group := range config.Groups {
+		key := fmt.Sprintf("group %q", group.Name)
+		replaced, err := l.claim(key, path, overlay)
+		if err != nil {
+			return err
+		}
+		if replaced {
+			l.config.Groups = replaceByName(l.config.Groups, group, func(g Group) string { return g.Name })
+			continue
+		}
+		l.config.Groups = append(l.config.Groups, group)
+	}
+
+	for _, file := range config.Files {
+		key := fmt.Sprintf("file %q", file.Name)
+		replaced, err := l.claim(key, path, overlay)
+		if err != nil {
+			return err
+		}
+		if replaced {
+			l.config.Files = replaceByName(l.config.Files, file, func(f File) string { return f.Name })
+			continue
+		}
+		l.config.Files = append(l.config.Files, file)
+	}
+
+	for _, mapping := range config.PropertyMappings {
+		key := fmt.Sprintf("property mapping %q", mapping.Property)
+		replaced, err := l.claim(key, path, overlay)
+		if err != nil {
+			return err
+		}
+		if replaced {
+			l.config.PropertyMappings = replaceByName(l.config.PropertyMappings, mapping, func(m PropertyMapping) string { return m.Property })
+			continue
+		}
+		l.config.PropertyMappings = append(l.config.PropertyMappings, mapping)
+	}
+
+	if config.PropertyPrecedence != "" {
+		if _, err := l.claim("property_precedence", path, overlay); err != nil {
+			return err
+		}
+		l.config.PropertyPrecedence = config.PropertyPrecedence
+	}
+
+	if config.BranchTemplate != "" {
+		if _, err := l.claim("branch_template", path, overlay); err != nil {
+			return err
+		}
+		l.config.BranchTemplate = config.BranchTemplate
+	}
+
+	if config.HumanCommits != "" {
+		if _, err := l.claim("human_commits", path, overlay); err != nil {
+			return err
+		}
+		l.config.HumanCommits = config.HumanCommits
+	}
+
+	if config.PrStrategy != "" {
+		if _, err := l.claim("pr_strategy", path, overlay); err != nil {
+			return err
+		}
+		l.config.PrStrategy = config.PrStrategy
+	}
+
+	if config.YearMode != "" {
+		if _, err := l.claim("year_mode", path, overlay); err != nil {
+			return err
+		}
+		l.config.YearMode = config.YearMode
+	}
+
+	if config.DefaultLicense != "" {
+		if _, err := l.claim("default_license", path, overlay); err != nil {
+			return err
+		}
+		l.config.DefaultLicense = config.DefaultLicense
+	}
+
+	if !reflect.ValueOf(config.Headers).IsZero() {
+		if _, err := l.claim("headers", path, overlay); err != nil {
+			return err
+		}
+		l.config.Headers = config.Headers
+	}
+
+	if !reflect.ValueOf(config.Properties).IsZero() {
+		if _, err := l.claim("properties", path, overlay); err != nil {
+			return err
+		}
+		l.config.Properties = config.Properties
+	}
+
+	if len(config.Variables) > 0 && l.config.Variables == nil {
+		l.config.Variables = map[string]string{}
+	}
+	for key, value := range config.Variables {
+		if _, err := l.claim(fmt.Sprintf("variable %q", key), path, overlay); err != nil {
+			return err
+		}
+		l.config.Variables[key] = value
+	}
+
+	return nil
+}
+
+// claim records that path defines key. It returns true if an overlay is replacing an existing
+// definition, and an error if a non-overlay file defines something another file already defined.
+func (l *loader) claim(key, path string, overlay bool) (bool, error) {
+	existing, ok := l.sources[key]
+	l.sources[key] = path
+	if !ok || existing == path {
+		return false, nil
+	}
+	if !overlay {
+		return false, fmt.Errorf("%s is defined in both %s and %s", key, existing, path)
+	}
+
+	return true, nil
+}
+
+// replaceByName replaces the first item with the same name as item
+func replaceByName[T any](items []T, item T, name func(T) string) []T {
+	for i := range items {
+		if name(items[i]) == name(item) {
+			items[i] = item
+			break
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,121 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestLoadConfigIncludesAndDirectories(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `
+includes:
+  - config.d/*.yaml
+groups:
+  - name: base
+    templates:
+      - dependabot
+`,
+		"config.d/dependabot.yaml": `
+files:
+  - name: dependabot
+    template_name: dependabot.yml
+    repo_path: .github/dependabot.yml
+variables:
+  DEPENDABOT_GOMOD_DIRECTORY: "/"
+`,
+		"config.d/go.yaml": `
+files:
+  - name: go-makefile
+    template_name: go-makefile
+    repo_path: Makefile
+variables:
+  CGO_ENABLED: "0"
+`,
+	})
+
+	cfg, err := config.LoadConfig(filepath.Join(dir, "config.yaml"))
+	assert.Nil(t, err)
+	assert.Len(t, cfg.Groups, 1)
+	assert.Len(t, cfg.Files, 2)
+	assert.Equal(t, map[string]string{"DEPENDABOT_GOMOD_DIRECTORY": "/", "CGO_ENABLED": "0"}, cfg.Variables)
+
+	// Loading the directory directly is equivalent for the files it contains
+	cfg, err = config.LoadConfig(filepath.Join(dir, "config.d"))
+	assert.Nil(t, err)
+	assert.Len(t, cfg.Files, 2)
+}
+
+func TestLoadConfigDuplicateDefinitions(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.d/a.yaml": `
+files:
+  - name: dependabot
+    repo_path: .github/dependabot.yml
+`,
+		"config.d/b.yaml": `
+files:
+  - name: dependabot
+    repo_path: .github/dependabot.yaml
+`,
+	})
+
+	_, err := config.LoadConfig(filepath.Join(dir, "config.d"))
+	assert.ErrorContains(t, err, `file "dependabot" is defined in both`)
+}
+
+func TestLoadConfigOverlays(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `
+files:
+  - name: dependabot
+    template_name: dependabot.yml
+    repo_path: .github/dependabot.yml
+variables:
+  COMPANY_NAME: "Chia Network Inc."
+  CGO_ENABLED: "0"
+`,
+		"overlay.yaml": `
+files:
+  - name: dependabot
+    template_name: other-dependabot.yml
+    repo_path: .github/dependabot.yml
+  - name: security
+    template_name: SECURITY.md
+    repo_path: SECURITY.md
+variables:
+  COMPANY_NAME: "Other Org"
+`,
+	})
+
+	cfg, err := config.LoadConfig(filepath.Join(dir, "config.yaml"), filepath.Join(dir, "overlay.yaml"))
+	assert.Nil(t, err)
+	assert.Len(t, cfg.Files, 2)
+	assert.Equal(t, "other-dependabot.yml", cfg.GetFileInfo("dependabot").TemplateName)
+	assert.Equal(t, map[string]string{"COMPANY_NAME": "Other Org", "CGO_ENABLED": "0"}, cfg.Variables)
+}
+
+func TestLoadConfigBranchTemplate(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `
+branch_template: "rcu/{{.Kind}}/{{.Group}}"
+`,
+	})
+
+	_, err := config.LoadConfig(filepath.Join(dir, "config.yaml"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// Properties configures the names and value semantics of the custom properties this tool reads.
+// Changing the names allows more than one independent instance of the tool to run in the same org.
+type Properties struct {
+	ManagedFiles  Property `yaml:"managed_files"`
+	ManageLicense Property `yaml:"manage_license"`
+	BypassPR      Property `yaml:"bypass_pr"`
+	PinVersions   Property `yaml:"pin_versions"`
+	ManageHeaders Property `yaml:"manage_headers"`
+}
+
+// Property is the name of a custom property, along with how its value is interpreted
+type Property struct {
+	Name string `yaml:"name"`
+
+	// Truthy lists the values that turn the property on, compared case-insensitively
+	Truthy []string `yaml:"truthy"`
+
+	// Separator splits list values
+	Separator string `yaml:"separator"`
+}
+
+// defaultProperties are the property names and values used when not set in the config
+var defaultProperties = Properties{
+	ManagedFiles:  Property{Name: "managed-files", Separator: ","},
+	ManageLicense: Property{Name: "manage-license", Truthy: []string{"yes"}},
+	BypassPR:      Property{Name: "repo-content-updater-bypass-pr", Truthy: []string{"true"}},
+	PinVersions:   Property{Name: "repo-content-updater-pin-versions", Separator: ","},
+	ManageHeaders: Property{Name: "manage-headers", Truthy: []string{"yes"}},
+}
+
+// GetProperties returns the custom property settings, with defaults filled in for anything not set
+func (c *Config) GetProperties() Properties {
+	return Properties{
+		ManagedFiles:  c.Properties.ManagedFiles.withDefaults(defaultProperties.ManagedFiles),
+		ManageLicense: c.Properties.ManageLicense.withDefaults(defaultProperties.ManageLicense),
+		BypassPR:      c.Properties.BypassPR.withDefaults(defaultProperties.BypassPR),
+		PinVersions:   c.Properties.PinVersions.withDefaults(defaultProperties.PinVersions),
+		ManageHeaders: c.Properties.ManageHeaders.withDefaults(defaultProperties.ManageHeaders),
+	}
+}
+
+func (p Property) withDefaults(defaults Property) Property {
+	if p.Name == "" {
+		p.Name = defaults.Name
+	}
+	if len(p.Truthy) == 0 {
+		p.Truthy = defaults.Truthy
+	}
+	if p.Separator == "" {
+		p.Separator = defaults.Separator
+	}
+	return p
+}
+
+// IsTruthy returns true if the value is one of the property's truthy values
+func (p Property) IsTruthy(value string) bool {
+	return slices.ContainsFunc(p.Truthy, func(truthy string) bool {
+		return strings.EqualFold(strings.TrimSpace(value), truthy)
+	})
+}
+
+// Split splits a list value on the property's separator, trimming whitespace and dropping empty entries
+func (p Property) Split(value string) []string {
+	separator := p.Separator
+	if separator == "" {
+		separator = ","
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
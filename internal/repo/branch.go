@@ -0,0 +1,404 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v59/github"
+	"github.com/spf13/viper"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+const (
+	// managedByTrailer is added to every commit the tool makes, so branches it created can be told
+	// apart from branches with the same name created by people
+	managedByTrailer = "Managed-By: repo-content-updater"
+
+	// pullRequestMarker is added to the body of every PR the tool opens
+	pullRequestMarker = "<!-- managed-by: repo-content-updater -->"
+
+	// redundantMarker identifies the comment left on a PR closed because its changes are no longer needed
+	redundantMarker = "<!-- repo-content-updater: redundant -->"
+
+	// humanCommitsMarker identifies the comment left on a PR whose branch was skipped because of
+	// commits from someone else
+	humanCommitsMarker = "<!-- repo-content-updater: human-commits -->"
+)
+
+// IsManagedCommit returns true if the commit was made by the tool, either because it has the
+// Managed-By trailer or because it was authored with the tool's committer email
+func IsManagedCommit(message, authorEmail, committerEmail string) bool {
+	for _, line := range strings.Split(message, "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), managedByTrailer) {
+			return true
+		}
+	}
+	return committerEmail != "" && strings.EqualFold(authorEmail, committerEmail)
+}
+
+// IsManagedPullRequest returns true if the PR was opened by the tool. Newer PRs have the marker in
+// their description. Older ones are recognized by being opened by the user the token belongs to, or
+// by every commit on their branch being made by the tool.
+func IsManagedPullRequest(body, author, tokenUser string, commits []*github.RepositoryCommit, committerEmail string) bool {
+	if strings.Contains(body, pullRequestMarker) {
+		return true
+	}
+	if tokenUser != "" && strings.EqualFold(author, tokenUser) {
+		return true
+	}
+	if len(commits) == 0 {
+		return false
+	}
+	for _, commit := range commits {
+		if !IsManagedCommit(commit.GetCommit().GetMessage(), commit.GetCommit().GetAuthor().GetEmail(), committerEmail) {
+			return false
+		}
+	}
+	return true
+}
+
+// isManagedPullRequest returns true if the PR was opened by the tool. PRs without the marker are only
+// recognized by their author or commits when their branch is one the tool could have named, and the
+// PR's commits are only listed when its author does not already tell.
+func (c *Content) isManagedPullRequest(cfg *config.Config, repoName string, pr *github.PullRequest) (bool, error) {
+	if strings.Contains(pr.GetBody(), pullRequestMarker) {
+		return true, nil
+	}
+	if !cfg.IsBranchName(pr.GetHead().GetRef()) {
+		return false, nil
+	}
+
+	tokenUser, err := c.tokenUser()
+	if err != nil {
+		return false, err
+	}
+	if IsManagedPullRequest(pr.GetBody(), pr.GetUser().GetLogin(), tokenUser, nil, c.committerEmail) {
+		return true, nil
+	}
+
+	var commits []*github.RepositoryCommit
+	opts := &github.ListOptions{
+		Page:    0,
+		PerPage: 100,
+	}
+	for {
+		opts.Page++
+		result, resp, err := ghDo(func() ([]*github.RepositoryCommit, *github.Response, error) {
+			return c.githubClient.PullRequests.ListCommits(context.TODO(), c.githubOrg, repoName, pr.GetNumber(), opts)
+		})
+		if err != nil {
+			return false, fmt.Errorf("error listing commits for %s: %w", pr.GetHTMLURL(), err)
+		}
+		commits = append(commits, result...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	return IsManagedPullRequest(pr.GetBody(), pr.GetUser().GetLogin(), tokenUser, commits, c.committerEmail), nil
+}
+
+// tokenUser returns the login of the user the GitHub token belongs to, looked up once per run
+func (c *Content) tokenUser() (string, error) {
+	if c.tokenLogin != nil {
+		return *c.tokenLogin, nil
+	}
+
+	user, _, err := ghDo(func() (*github.User, *github.Response, error) {
+		return c.githubClient.Users.Get(context.TODO(), "")
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting the token's user: %w", err)
+	}
+	c.tokenLogin = github.String(user.GetLogin())
+
+	return *c.tokenLogin, nil
+}
+
+// remoteBranch is a branch the tool is about to push that already exists in the repo
+type remoteBranch struct {
+	sha string
+
+	// managedCommits counts the commits on top of the target branch made by the tool, and
+	// otherCommits lists the ones made by anyone else, oldest first
+	managedCommits int
+	otherCommits   []string
+
+	// tipManaged is true if the commit the branch points to was made by the tool
+	tipManaged bool
+}
+
+// createdByTool returns true if the branch was created by the tool. A branch with nothing on top of
+// the target branch is only the tool's if its tip commit was made by the tool, so a branch someone
+// just created with the same name is not mistaken for it.
+func (b *remoteBranch) createdByTool() bool {
+	if b.managedCommits > 0 {
+		return true
+	}
+	return len(b.otherCommits) == 0 && b.tipManaged
+}
+
+// inspectBranch returns the branch in the repo along with who made its commits on top of the target
+// branch, or nil if the branch does not exist
+func (c *Content) inspectBranch(repoName, branchName, targetBranch string) (*remoteBranch, error) {
+	branch, _, err := ghDo(func() (*github.Branch, *github.Response, error) {
+		return c.githubClient.Repositories.GetBranch(context.TODO(), c.githubOrg, repoName, branchName, 1)
+	})
+	if err != nil {
+		var ghErr *github.ErrorResponse
+		if errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting branch %s: %w", branchName, err)
+	}
+
+	comparison, _, err := ghDo(func() (*github.CommitsComparison, *github.Response, error) {
+		return c.githubClient.Repositories.CompareCommits(context.TODO(), c.githubOrg, repoName, targetBranch, branchName, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error comparing branch %s to %s: %w", branchName, targetBranch, err)
+	}
+
+	tip := branch.GetCommit().GetCommit()
+	remote := &remoteBranch{
+		sha:        branch.GetCommit().GetSHA(),
+		tipManaged: IsManagedCommit(tip.GetMessage(), tip.GetAuthor().GetEmail(), c.committerEmail),
+	}
+	for _, commit := range comparison.Commits {
+		if IsManagedCommit(commit.GetCommit().GetMessage(), commit.GetCommit().GetAuthor().GetEmail(), c.committerEmail) {
+			remote.managedCommits++
+		} else {
+			remote.otherCommits = append(remote.otherCommits, commit.GetSHA())
+		}
+	}
+
+	return remote, nil
+}
+
+// humanCommitsMode returns what to do with commits from someone else on the tool's branches,
+// preferring the repo config over the org config
+func humanCommitsMode(cfg *config.Config, repoConfig Config) string {
+	if repoConfig.HumanCommits != nil && *repoConfig.HumanCommits != "" {
+		return *repoConfig.HumanCommits
+	}
+	if cfg.HumanCommits != "" {
+		return cfg.HumanCommits
+	}
+	return config.HumanCommitsSkip
+}
+
+// branchStart is how a branch update is made and pushed, decided before any changes are made. Every
+// branch update starts from the PR target branch.
+type branchStart struct {
+	// force pushes over the existing branch, which has no commits from anyone else
+	force bool
+
+	// replay lists the commits someone else pushed to the existing branch, oldest first. They are
+	// applied on top of the changes, so the branch is rebased onto the latest target branch.
+	replay []string
+
+	// lease is the commit the existing branch must still point to when a rebased branch is pushed
+	lease plumbing.Hash
+}
+
+// prepareBranch decides how a branch update is made. A new branch, or one with only the tool's
+// commits, is force pushed. A branch created by someone else is never touched. When someone else
+// pushed commits to the tool's branch, human_commits either skips the branch and comments on its
+// PR, or replays those commits on top of the changes. nil is returned if the branch is skipped.
+func (c *Content) prepareBranch(u *repoUpdate, cfg *config.Config, branchName, targetBranch string) (*branchStart, error) {
+	if !viper.GetBool("push") || u.props.BypassPR {
+		return &branchStart{force: true}, nil
+	}
+
+	remote, err := c.inspectBranch(u.name, branchName, targetBranch)
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil {
+		return &branchStart{force: true}, nil
+	}
+	if !remote.createdByTool() {
+		return nil, fmt.Errorf("refusing to overwrite branch %s, it was not created by repo-content-updater", branchName)
+	}
+	if len(remote.otherCommits) == 0 {
+		return &branchStart{force: true}, nil
+	}
+
+	if humanCommitsMode(cfg, u.config) == config.HumanCommitsRebase {
+		log.Printf("Branch %s has commits not made by repo-content-updater, applying them on top of the changes\n", branchName)
+		return &branchStart{replay: remote.otherCommits, lease: plumbing.NewHash(remote.sha)}, nil
+	}
+
+	return nil, c.skipHumanCommits(u, branchName, "it was not updated to avoid overwriting them")
+}
+
+// skipHumanCommits records a branch with commits from someone else as skipped, and comments once on
+// its PR explaining why it was not updated
+func (c *Content) skipHumanCommits(u *repoUpdate, branchName, why string) error {
+	reason := fmt.Sprintf("branch %s has commits not made by repo-content-updater", branchName)
+	log.Printf("Skipping %s: %s\n", u.name, reason)
+	c.report.Add(u.name, "", StatusSkipped, reason)
+	return c.commentOnPullRequest(u.name, branchName, humanCommitsMarker, fmt.Sprintf(
+		"%s\n\nThis branch has commits that were not made by repo-content-updater, so %s. "+
+			"Merge or close this PR so the next run can open a fresh one, or set `human_commits: rebase` to apply those commits on top of updates.",
+		humanCommitsMarker, why,
+	))
+}
+
+// errReplayConflict is returned when commits from someone else do not apply on top of the changes
+var errReplayConflict = errors.New("commits do not apply on top of the changes")
+
+// replayCommits applies the commits to the clone's current branch, keeping their authors and messages
+func (c *Content) replayCommits(u *repoUpdate, shas []string) error {
+	var patches []string
+	for _, sha := range shas {
+		patch, _, err := ghDo(func() (string, *github.Response, error) {
+			return c.githubClient.Repositories.GetCommitRaw(context.TODO(), c.githubOrg, u.name, sha, github.RawOptions{Type: github.Patch})
+		})
+		if err != nil {
+			return fmt.Errorf("error getting commit %s: %w", sha, err)
+		}
+		patches = append(patches, patch)
+	}
+
+	return applyCommitPatches(u.dir, patches, c.committerName, c.committerEmail, viper.GetBool("sign-commits"))
+}
+
+// applyCommitPatches applies patches in the format-patch format as commits with git am. If any
+// patch does not apply, the ones already applied are undone and errReplayConflict is returned.
+func applyCommitPatches(dir string, patches []string, committerName, committerEmail string, sign bool) error {
+	args := []string{"-C", dir, "-c", "user.name=" + committerName, "-c", "user.email=" + committerEmail, "am", "--keep-cr"}
+	if sign {
+		args = append(args, "-S")
+	}
+
+	head, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("error reading HEAD: %w", err)
+	}
+
+	for _, patch := range patches {
+		cmd := exec.Command("git", args...)
+		cmd.Stdin = strings.NewReader(patch)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			_ = exec.Command("git", "-C", dir, "am", "--abort").Run()
+			_ = exec.Command("git", "-C", dir, "reset", "--hard", strings.TrimSpace(string(head))).Run()
+			return fmt.Errorf("%w: %s", errReplayConflict, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// findPullRequest returns the open PR from the branch, or nil if there is none
+func (c *Content) findPullRequest(repoName, branchName string) (*github.PullRequest, error) {
+	prs, _, err := ghDo(func() ([]*github.PullRequest, *github.Response, error) {
+		return c.githubClient.PullRequests.List(context.TODO(), c.githubOrg, repoName, &github.PullRequestListOptions{
+			State: "open",
+			Head:  fmt.Sprintf("%s:%s", c.githubOrg, branchName),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pull requests for %s: %w", branchName, err)
+	}
+	if len(prs) == 0 {
+		return nil, nil
+	}
+
+	return prs[0], nil
+}
+
+// commentOnPullRequest comments on the open PR from the branch, if there is one. The comment is
+// only made once, recognized by the marker it contains.
+func (c *Content) commentOnPullRequest(repoName, branchName, marker, body string) error {
+	pr, err := c.findPullRequest(repoName, branchName)
+	if err != nil || pr == nil {
+		return err
+	}
+
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{
+			Page:    0,
+			PerPage: 100,
+		},
+	}
+	for {
+		opts.Page++
+		comments, resp, err := ghDo(func() ([]*github.IssueComment, *github.Response, error) {
+			return c.githubClient.Issues.ListComments(context.TODO(), c.githubOrg, repoName, pr.GetNumber(), opts)
+		})
+		if err != nil {
+			return fmt.Errorf("error listing comments on %s: %w", pr.GetHTMLURL(), err)
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), marker) {
+				return nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	_, _, err = ghDo(func() (*github.IssueComment, *github.Response, error) {
+		return c.githubClient.Issues.CreateComment(context.TODO(), c.githubOrg, repoName, pr.GetNumber(), &github.IssueComment{Body: github.String(body)})
+	})
+	if err != nil {
+		return fmt.Errorf("error commenting on %s: %w", pr.GetHTMLURL(), err)
+	}
+	log.Printf("Commented on %s\n", pr.GetHTMLURL())
+
+	return nil
+}
+
+// closeRedundantPullRequest closes the open PR from the branch when the branch no longer has any
+// changes to make, such as when someone already made them by hand or a template was reverted. The
+// PR is only closed if the tool opened it, and its branch is deleted along with it.
+func (c *Content) closeRedundantPullRequest(cfg *config.Config, repoName, branchName string) error {
+	if !viper.GetBool("push") {
+		return nil
+	}
+
+	pr, err := c.findPullRequest(repoName, branchName)
+	if err != nil || pr == nil {
+		return err
+	}
+	managed, err := c.isManagedPullRequest(cfg, repoName, pr)
+	if err != nil || !managed {
+		return err
+	}
+
+	err = c.commentOnPullRequest(repoName, branchName, redundantMarker, fmt.Sprintf(
+		"%s\n\nClosing this PR, since the target branch already matches the managed content and there are no changes left to make.",
+		redundantMarker,
+	))
+	if err != nil {
+		return err
+	}
+
+	_, _, err = ghDo(func() (*github.PullRequest, *github.Response, error) {
+		return c.githubClient.PullRequests.Edit(context.TODO(), c.githubOrg, repoName, pr.GetNumber(), &github.PullRequest{State: github.String("closed")})
+	})
+	if err != nil {
+		return fmt.Errorf("error closing %s: %w", pr.GetHTMLURL(), err)
+	}
+
+	_, err = ghDoNoBody(func() (*github.Response, error) {
+		return c.githubClient.Git.DeleteRef(context.TODO(), c.githubOrg, repoName, fmt.Sprintf("heads/%s", branchName))
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting branch %s: %w", branchName, err)
+	}
+	log.Printf("Closed %s and deleted branch %s, its changes are no longer needed\n", pr.GetHTMLURL(), branchName)
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package repo_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestIsManagedCommit(t *testing.T) {
+	assert.True(t, repo.IsManagedCommit("Update LICENSE\n\nManaged-By: repo-content-updater\nConfig-Revision: abc", "someone@example.com", "bot@example.com"))
+	assert.True(t, repo.IsManagedCommit("Update LICENSE", "Bot@example.com", "bot@example.com"))
+	assert.False(t, repo.IsManagedCommit("Fix the workflow", "someone@example.com", "bot@example.com"))
+	assert.False(t, repo.IsManagedCommit("Fix the workflow", "", ""))
+}
+
+// commit returns a PR commit with the message and author email
+func commit(message, authorEmail string) *github.RepositoryCommit {
+	return &github.RepositoryCommit{Commit: &github.Commit{Message: github.String(message), Author: &github.CommitAuthor{Email: github.String(authorEmail)}}}
+}
+
+func TestIsManagedPullRequest(t *testing.T) {
+	managed := commit("Update LICENSE", "bot@example.com")
+	human := commit("Fix the workflow", "someone@example.com")
+
+	// Recognized by the marker in the description
+	assert.True(t, repo.IsManagedPullRequest("Updates files\n\n<!-- managed-by: repo-content-updater -->", "someone", "bot", nil, "bot@example.com"))
+
+	// Older PRs have an empty description, and are recognized by their author or commits
+	assert.True(t, repo.IsManagedPullRequest("", "Bot", "bot", []*github.RepositoryCommit{human}, "bot@example.com"))
+	assert.True(t, repo.IsManagedPullRequest("", "someone", "bot", []*github.RepositoryCommit{managed, managed}, "bot@example.com"))
+	assert.False(t, repo.IsManagedPullRequest("", "someone", "bot", []*github.RepositoryCommit{managed, human}, "bot@example.com"))
+	assert.False(t, repo.IsManagedPullRequest("", "someone", "bot", nil, "bot@example.com"))
+	assert.False(t, repo.IsManagedPullRequest("", "", "", nil, "bot@example.com"))
+}
+
+func TestCreatedByTool(t *testing.T) {
+	assert.True(t, repo.CreatedByTool(2, 0, true))
+	assert.True(t, repo.CreatedByTool(1, 1, false))
+	assert.False(t, repo.CreatedByTool(0, 1, false))
+
+	// Nothing on top of the target branch, such as a branch someone just created
+	assert.True(t, repo.CreatedByTool(0, 0, true))
+	assert.False(t, repo.CreatedByTool(0, 0, false))
+}
+
+// gitRun runs git in dir, failing the test on error
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=Someone", "-c", "user.email=someone@example.com", "-c", "commit.gpgsign=false"}, args...)
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return string(output)
+}
+
+// writeAndCommit writes the file and commits it
+func writeAndCommit(t *testing.T, dir, name, content, message string) {
+	t.Helper()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-m", message)
+}
+
+func TestApplyCommitPatches(t *testing.T) {
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q", "-b", "main")
+	writeAndCommit(t, dir, "workflow.yml", "name: build\nruns-on: ubuntu-latest\njobs:\n  build:\n    timeout-minutes: 30\n    permissions:\n      contents: read\nsteps: []\n", "Initial commit")
+	base := strings.TrimSpace(gitRun(t, dir, "rev-parse", "HEAD"))
+
+	// Someone fixes a managed file on the tool's branch
+	writeAndCommit(t, dir, "workflow.yml", "name: build\nruns-on: ubuntu-latest\njobs:\n  build:\n    timeout-minutes: 30\n    permissions:\n      contents: read\nsteps: [checkout]\n", "Fix the workflow steps")
+	patch := gitRun(t, dir, "format-patch", "-1", "--stdout")
+
+	// The next run starts again from the target branch and changes a different line of the same file
+	gitRun(t, dir, "reset", "-q", "--hard", base)
+	writeAndCommit(t, dir, "workflow.yml", "name: build\nruns-on: ubuntu-24.04\njobs:\n  build:\n    timeout-minutes: 30\n    permissions:\n      contents: read\nsteps: []\n", "Update workflow.yml")
+
+	assert.Nil(t, repo.ApplyCommitPatches(dir, []string{patch}, "Bot", "bot@example.com", false))
+	content, err := os.ReadFile(filepath.Join(dir, "workflow.yml"))
+	assert.Nil(t, err)
+	assert.Equal(t, "name: build\nruns-on: ubuntu-24.04\njobs:\n  build:\n    timeout-minutes: 30\n    permissions:\n      contents: read\nsteps: [checkout]\n", string(content))
+	assert.Equal(t, "Someone <someone@example.com>", strings.TrimSpace(gitRun(t, dir, "log", "-1", "--format=%an <%ae>")))
+	assert.Equal(t, "Fix the workflow steps", strings.TrimSpace(gitRun(t, dir, "log", "-1", "--format=%s")))
+
+	// The same line changed by both conflicts, leaving the changes as they were
+	gitRun(t, dir, "reset", "-q", "--hard", base)
+	writeAndCommit(t, dir, "workflow.yml", "name: build\nruns-on: ubuntu-latest\njobs:\n  build:\n    timeout-minutes: 30\n    permissions:\n      contents: read\nsteps: [setup]\n", "Update workflow.yml")
+	updated := strings.TrimSpace(gitRun(t, dir, "rev-parse", "HEAD"))
+
+	err = repo.ApplyCommitPatches(dir, []string{patch}, "Bot", "bot@example.com", false)
+	assert.ErrorIs(t, err, repo.ErrReplayConflict)
+	assert.Equal(t, updated, strings.TrimSpace(gitRun(t, dir, "rev-parse", "HEAD")))
+	assert.Empty(t, gitRun(t, dir, "status", "--porcelain"))
+}
@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
@@ -20,34 +22,68 @@ import (
 // Content the content manager object
 type Content struct {
 	templates      string
+	partials       map[string]string
 	githubOrg      string
 	committerName  string
 	committerEmail string
 	reviewTeamName string
 	githubToken    string
 	githubClient   *github.Client
+	report         *Report
+	layerCache     map[string]cachedLayer
+	orgRepos       map[string]*github.Repository
+	teamRepos      map[string]map[string]bool
+
+	// tokenLogin is the login of the user the GitHub token belongs to, once looked up
+	tokenLogin *string
+
+	// cloneDir holds the clones for this run. It is unique per run, so several runs can work
+	// on the same repo at the same time.
+	cloneDir string
 }
 
 // NewContent returns new repo content manager
-func NewContent(templates, githubOrg, committerName, committerEmail, reviewTeam, githubToken string) (*Content, error) {
+func NewContent(templates, partialsDir, githubOrg, committerName, committerEmail, reviewTeam, githubToken string) (*Content, error) {
+	partials, err := LoadPartials(partialsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading partials: %w", err)
+	}
+
 	client := github.NewClient(nil).WithAuthToken(githubToken)
 	return &Content{
 		templates:      templates,
+		partials:       partials,
 		githubOrg:      githubOrg,
 		committerName:  committerName,
 		committerEmail: committerEmail,
 		reviewTeamName: reviewTeam,
 		githubToken:    githubToken,
 		githubClient:   client,
+		report:         &Report{},
+		layerCache:     map[string]cachedLayer{},
+		teamRepos:      map[string]map[string]bool{},
+		cloneDir:       filepath.Join("clones", fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())),
 	}, nil
 }
 
-func repoDir(repoName string) string {
-	return fmt.Sprintf("clones/%s", repoName)
+// Report returns the report of outcomes recorded during the run
+func (c *Content) Report() *Report {
+	return c.report
+}
+
+func (c *Content) repoDir(repoName string) string {
+	return filepath.Join(c.cloneDir, repoName)
+}
+
+// removeClone deletes the clone of the repo, along with the run's clone directory once it is empty
+func (c *Content) removeClone(repoName string) {
+	removeDirIfExists(c.repoDir(repoName))
+	// Only succeeds if no other clones are left
+	_ = os.Remove(c.cloneDir)
 }
 
 func (c *Content) cloneRepo(repoName string) (*git.Repository, *git.Worktree, error) {
-	_, err := git.PlainClone(repoDir(repoName), false, &git.CloneOptions{
+	_, err := git.PlainClone(c.repoDir(repoName), false, &git.CloneOptions{
 		URL:          fmt.Sprintf("https://%s@github.com/%s/%s", c.githubToken, c.githubOrg, repoName),
 		SingleBranch: true,
 		Depth:        1,
@@ -56,7 +92,7 @@ func (c *Content) cloneRepo(repoName string) (*git.Repository, *git.Worktree, er
 		return nil, nil, err
 	}
 
-	r, err := git.PlainOpen(repoDir(repoName))
+	r, err := git.PlainOpen(c.repoDir(repoName))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -149,8 +185,9 @@ func (c *Content) createBranch(r *git.Repository, w *git.Worktree, branchName st
 }
 
 func (c *Content) commit(w *git.Worktree, repoName string, message string) error {
+	message = addRevisionTrailers(message)
 	if viper.GetBool("sign-commits") {
-		err := signCommit(repoDir(repoName), message)
+		err := signCommit(c.repoDir(repoName), message)
 		if err != nil {
 			return fmt.Errorf("error signing commit %w", err)
 		}
@@ -175,6 +212,12 @@ func (c *Content) commit(w *git.Worktree, repoName string, message string) error
 // properties can be added here without changing call sites.
 type CustomProperties struct {
 	BypassPR bool
+
+	// PinVersions maps managed file names to the template version the repo is pinned to
+	PinVersions map[string]string
+
+	// Values holds every raw custom property value set on the repo, keyed by property name
+	Values map[string]string
 }
 
 type pushAndPROptions struct {
@@ -182,6 +225,14 @@ type pushAndPROptions struct {
 	AssignUsers    []string
 	AssignGroup    *string
 	BypassPR       bool
+
+	// Force pushes over the existing branch. It is only set when the branch has no commits from
+	// anyone other than the tool, so an old unmerged version of the branch can be replaced.
+	Force bool
+
+	// Lease force pushes over the existing branch only if it still points to this commit, so
+	// commits pushed by someone else after it was read are not lost
+	Lease plumbing.Hash
 }
 
 func (c *Content) pushAndPR(r *git.Repository, repoName, branchName, title string, opts *pushAndPROptions) error {
@@ -206,10 +257,24 @@ func (c *Content) pushAndPR(r *git.Repository, repoName, branchName, title strin
 		return nil
 	}
 
-	// Push the new branch to the remote
-	err := r.Push(&git.PushOptions{
-		Force: true, // Force push in case there are updates to an old unmerged existing version of this branch
-	})
+	// Push the new branch to the remote. Only this branch is pushed, since the clone may hold other
+	// branches for other PRs.
+	pushOpts := &git.PushOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("refs/heads/%s:refs/heads/%s", branchName, branchName)),
+		},
+		Force: opts.Force,
+	}
+	if !opts.Lease.IsZero() {
+		// The lease is checked against the remote tracking ref, which a shallow clone of the target
+		// branch does not have
+		err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", branchName), opts.Lease))
+		if err != nil {
+			return fmt.Errorf("error setting remote ref for %s: %w", branchName, err)
+		}
+		pushOpts.ForceWithLease = &git.ForceWithLease{RefName: plumbing.NewBranchReferenceName(branchName), Hash: opts.Lease}
+	}
+	err := r.Push(pushOpts)
 	if err != nil {
 		if errors.Is(err, git.NoErrAlreadyUpToDate) {
 			return fmt.Errorf("branch was already up to date even though there were changes")
@@ -218,8 +283,28 @@ func (c *Content) pushAndPR(r *git.Repository, repoName, branchName, title strin
 	}
 	fmt.Println("Branch pushed successfully")
 
+	existing, err := c.findPullRequest(repoName, branchName)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		// Keep the title and revisions in the description in line with the new commits
+		_, _, err = ghDo(func() (*github.PullRequest, *github.Response, error) {
+			return c.githubClient.PullRequests.Edit(context.TODO(), c.githubOrg, repoName, existing.GetNumber(), &github.PullRequest{
+				Title: github.String(title),
+				Body:  github.String(pullRequestBody()),
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("error updating pull request: %w", err)
+		}
+		log.Printf("Updated existing PR %s\n", existing.GetHTMLURL())
+		return nil
+	}
+
 	newPR := &github.NewPullRequest{
 		Title:               github.String(title),
+		Body:                github.String(pullRequestBody()),
 		Head:                github.String(branchName),
 		Base:                opts.PrTargetBranch,
 		MaintainerCanModify: github.Bool(true),
@@ -270,6 +355,32 @@ func (c *Content) ensureGroupMembership(repoName string) error {
 	return err
 }
 
+// addRevisionTrailers appends git trailers marking the commit as made by this tool, and recording
+// the template and config revisions when they were loaded from a remote git repository, so every
+// change can be traced back to them
+func addRevisionTrailers(message string) string {
+	trailers := []string{managedByTrailer}
+	if revision := viper.GetString("templates-revision"); revision != "" {
+		trailers = append(trailers, fmt.Sprintf("Templates-Revision: %s", revision))
+	}
+	if revision := viper.GetString("config-revision"); revision != "" {
+		trailers = append(trailers, fmt.Sprintf("Config-Revision: %s", revision))
+	}
+	return fmt.Sprintf("%s\n\n%s", message, strings.Join(trailers, "\n"))
+}
+
+// pullRequestBody returns the description for PRs opened by this tool
+func pullRequestBody() string {
+	body := "This PR was opened by repo-content-updater to bring managed files in line with the upstream templates.\n\n" + pullRequestMarker
+	if revision := viper.GetString("templates-revision"); revision != "" {
+		body += fmt.Sprintf("\n\nTemplates revision: `%s`", revision)
+	}
+	if revision := viper.GetString("config-revision"); revision != "" {
+		body += fmt.Sprintf("\n\nConfig revision: `%s`", revision)
+	}
+	return body
+}
+
 func signCommit(dir string, message string) error {
 	cmd := exec.Command("git", "-C", dir, "commit", "-S", "-m", message)
 	err := cmd.Run()
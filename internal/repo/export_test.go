@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// IsProtected exposes isProtected to the repo_test package
+func (c Config) IsProtected(repoPath string) bool {
+	return c.isProtected(repoPath)
+}
+
+// AppendContent exposes appendContent to the repo_test package
+var AppendContent = appendContent
+
+// SelectFiles runs selectFiles for the named repo, returning the report of skipped files
+func SelectFiles(repoName string, files []config.FileRef, cfg *config.Config, repoConfig Config) ([]config.FileRef, *Report, error) {
+	c := &Content{report: &Report{}}
+	selected, err := c.selectFiles(repoName, files, cfg, repoConfig, RepoFacts{Name: repoName})
+	return selected, c.report, err
+}
+
+// LicenseFor runs licenseFor for the repo, returning the report of skipped licenses
+func LicenseFor(cfg *config.Config, repo *github.RepoCustomPropertyValue) (*config.File, *Report) {
+	c := &Content{report: &Report{}}
+	return c.licenseFor(cfg, repo), c.report
+}
+
+// CreatedByTool runs createdByTool for a branch with the given commits on top of the target branch
+func CreatedByTool(managedCommits, otherCommits int, tipManaged bool) bool {
+	return (&remoteBranch{managedCommits: managedCommits, otherCommits: make([]string, otherCommits), tipManaged: tipManaged}).createdByTool()
+}
+
+// ApplyCommitPatches exposes applyCommitPatches to the repo_test package
+var ApplyCommitPatches = applyCommitPatches
+
+// ErrReplayConflict exposes errReplayConflict to the repo_test package
+var ErrReplayConflict = errReplayConflict
+
+// ApplyPatch exposes applyPatch to the repo_test package
+var ApplyPatch = applyPatch
+
+// HasStagedChanges exposes hasStagedChanges to the repo_test package
+var HasStagedChanges = hasStagedChanges
+
+// SetClock replaces the clock used for the current year until the test finishes
+func SetClock(t *testing.T, now time.Time) {
+	previous := clock
+	t.Cleanup(func() { clock = previous })
+	clock = func() time.Time { return now }
+}
@@ -1,223 +1,270 @@
 package repo
 
 import (
-	"context"
-	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
+	"slices"
 
 	"github.com/google/go-github/v59/github"
 
 	"github.com/chia-network/repo-content-updater/internal/config"
 )
 
-type repoFilesEntry struct {
-	files []string
-	props CustomProperties
-}
-
-// ManagedFiles updates all managed files in the org with current versions
-func (c *Content) ManagedFiles(cfg *config.Config, onlyRepo string) error {
-	reposToCheck := map[string]repoFilesEntry{}
-
-	opts := &github.ListOptions{
-		Page:    0,
-		PerPage: 100,
-	}
-	for {
-		opts.Page++
-		result, resp, err := ghDo(func() ([]*github.RepoCustomPropertyValue, *github.Response, error) {
-			return c.githubClient.Organizations.ListCustomPropertyValues(context.TODO(), c.githubOrg, opts)
-		})
-		if err != nil {
-			return err
+// ManagedFiles updates all managed files in the repos matched by the selector with current versions
+func (c *Content) ManagedFiles(cfg *config.Config, sel *Selector) error {
+	return c.forEachRepo(cfg, sel, func(repo *github.RepoCustomPropertyValue) (repoJob, error) {
+		files := managedFilesFor(cfg, repo)
+		if files == nil {
+			return nil, nil
 		}
+		return func(repoName string, props CustomProperties) error {
+			return c.CheckFiles(repoName, files, cfg, props)
+		}, nil
+	})
+}
 
-		for _, repo := range result {
-			if onlyRepo != "" && !strings.EqualFold(repo.RepositoryName, onlyRepo) {
-				continue
-			}
-			entry := reposToCheck[repo.RepositoryName]
-			for _, property := range repo.Properties {
-				if property.PropertyName == "managed-files" && property.Value != nil {
-					var finalFiles []string
-					files := strings.Split(*property.Value, ",")
-					for _, file := range files {
-						file = strings.TrimSpace(file)
-						if strings.HasPrefix(file, "group:") {
-							group := file[len("group:"):]
-							groupFiles, err := cfg.ExpandGroup(group)
-							if err != nil {
-								log.Printf("Error expanding group %s: %s\n", group, err.Error())
-								continue
-							}
-
-							finalFiles = append(finalFiles, groupFiles...)
-						} else {
-							finalFiles = append(finalFiles, file)
-						}
-					}
-
-					entry.files = finalFiles
-				}
+// managedFilesFor resolves the repo's managed files property, or returns nil if it is not set
+func managedFilesFor(cfg *config.Config, repo *github.RepoCustomPropertyValue) []config.FileRef {
+	var files []config.FileRef
+	for _, property := range repo.Properties {
+		if property.PropertyName == cfg.GetProperties().ManagedFiles.Name && property.Value != nil {
+			resolved, err := cfg.ResolveFiles(*property.Value)
+			if err != nil {
+				log.Printf("Error resolving managed files for %s: %s\n", repo.RepositoryName, err.Error())
 			}
-			entry.props = parseCustomProperties(repo.Properties)
-			reposToCheck[repo.RepositoryName] = entry
-		}
 
-		if resp.NextPage == 0 {
-			break
+			files = resolved
 		}
 	}
-
-	for repo, entry := range reposToCheck {
-		if entry.files == nil {
-			continue
-		}
-		log.Printf("Need to check %s\n", repo)
-		err := c.CheckFiles(repo, entry.files, cfg, entry.props)
-		if err != nil {
-			log.Printf("Error updating %s: %s\n", repo, err.Error())
-			continue
-		}
-	}
-
-	return nil
+	return files
 }
 
 // CheckFiles checks all the files for updates in the repo
-func (c *Content) CheckFiles(repoName string, files []string, cfg *config.Config, props CustomProperties) error {
-	defer removeDirIfExists(repoDir(repoName))
+func (c *Content) CheckFiles(repoName string, files []config.FileRef, cfg *config.Config, props CustomProperties) error {
+	return c.updateRepo(repoName, cfg, props, c.managedFilesPlan(files, cfg))
+}
 
-	r, w, err := c.cloneRepo(repoName)
-	if err != nil {
-		return err
-	}
+// managedFilesPlan returns the plan for the managed-files command
+func (c *Content) managedFilesPlan(files []config.FileRef, cfg *config.Config) updatePlan {
+	return c.planFiles(files, cfg, config.BranchKindManagedFiles, "Update Managed Files", true)
+}
 
-	repoConfig, err := c.LoadRepoConfig(repoDir(repoName))
-	if err != nil {
-		log.Printf("Error loading config for %s: %v\n", repoName, err)
-	}
+// planFiles returns a plan writing the rendered files with a commit per changed file. Changes are
+// pushed on the branch for the kind with a PR using the given title. If split is set, the changes
+// are split into several branches and PRs following the repo's pr_strategy, unless the repo bypasses PRs.
+func (c *Content) planFiles(files []config.FileRef, cfg *config.Config, kind, title string, split bool) updatePlan {
+	return func(u *repoUpdate) ([]branchUpdate, error) {
+		selected, err := c.selectFiles(u.name, files, cfg, u.config, u.facts)
+		if err != nil {
+			return nil, err
+		}
 
-	headRef, err := r.Head()
-	if err != nil {
-		return fmt.Errorf("error getting head ref for %s: %w", repoName, err)
-	}
-	headRefName := headRef.Name()
-	if !headRefName.IsBranch() {
-		return errors.New("HEAD ref is not a branch")
-	}
-	defaultBranch := headRefName.Short()
+		// Repos that bypass PRs push every branch straight to the target branch, so the changes
+		// must be a single branch, or every push after the first would not be a fast forward
+		strategy := config.PrStrategySingle
+		if split && !u.props.BypassPR {
+			strategy = prStrategy(cfg, u.config)
+		}
 
-	// If we are targeting a different branch with PRs, then our base also needs to start from that branch
-	if repoConfig.PrTargetBranch != nil && *repoConfig.PrTargetBranch != defaultBranch {
-		err = c.checkoutBranch(r, w, *repoConfig.PrTargetBranch)
-		if err != nil {
-			return fmt.Errorf("error checking out branch %s: %w", *repoConfig.PrTargetBranch, err)
+		var updates []branchUpdate
+		for _, pr := range PlanPRs(strategy, selected, title) {
+			branchName, err := cfg.BranchName(config.BranchData{Kind: kind, Group: pr.Group, File: pr.File})
+			if err != nil {
+				return nil, err
+			}
+			// Each branch is reset before its changes are made, so PRs sharing a branch would
+			// overwrite each other
+			if slices.ContainsFunc(updates, func(other branchUpdate) bool { return other.branch == branchName }) {
+				return nil, fmt.Errorf("branch_template renders %q for more than one PR with pr_strategy %s", branchName, strategy)
+			}
+			updates = append(updates, branchUpdate{
+				branch: branchName,
+				title:  pr.Title,
+				update: func(u *repoUpdate) (bool, error) {
+					return c.writeFiles(u, pr.Files, cfg)
+				},
+			})
 		}
+		return updates, nil
 	}
+}
 
-	branchName := "managed-files"
-	err = c.createBranch(r, w, branchName)
-	if err != nil {
-		return err
-	}
+// writeFiles writes the files to the clone with a commit per changed file, and returns true if
+// anything was committed
+func (c *Content) writeFiles(u *repoUpdate, files []config.FileRef, cfg *config.Config) (bool, error) {
+	repoName, repoConfig, w := u.name, u.config, u.worktree
+
+	// Pins in the repo config take precedence over pins from custom properties
+	pins := map[string]string{}
+	maps.Copy(pins, u.props.PinVersions)
+	maps.Copy(pins, repoConfig.PinVersions)
 
 	hadChanges := false
-	for _, file := range files {
+	for _, ref := range files {
+		fileinfo := cfg.GetFileInfo(ref.Name)
+		file := fileinfo.Name
 		log.Printf(" - Checking %s\n", file)
 
-		fileinfo := cfg.GetFileInfo(file)
-		if fileinfo == nil {
-			log.Printf("unknown file %s. Skipping...", file)
+		// A bad pin only affects its own file, the rest of the branch is still updated
+		templateName, err := fileinfo.TemplateFor(pins[file])
+		if err != nil {
+			log.Printf(" - Skipping %s: %s\n", file, err.Error())
+			c.report.Add(repoName, file, StatusFailed, err.Error())
 			continue
 		}
+		if templateName != fileinfo.TemplateName {
+			reason := fmt.Sprintf("pinned to version %s, latest is %s", pins[file], fileinfo.Version)
+			log.Printf(" - %s is %s\n", file, reason)
+			c.report.Add(repoName, file, StatusBehind, reason)
+		}
+
+		if fileinfo.License != "" {
+			reason, err := checkExistingLicense(u.dir, fileinfo)
+			if err != nil {
+				return false, err
+			}
+			if reason != "" {
+				log.Printf(" - Skipping %s: %s\n", file, reason)
+				c.report.Add(repoName, file, StatusLegalReview, reason)
+				continue
+			}
+		}
 
 		for _, form := range fileinfo.AlternatePaths {
+			if repoConfig.isProtected(form) {
+				continue
+			}
 			// Ignoring errors since these alternate file names may not exist
-			removePath := fmt.Sprintf("%s/%s", repoDir(repoName), form)
+			removePath := fmt.Sprintf("%s/%s", u.dir, form)
 			_ = os.Remove(removePath)
 			_, _ = w.Add(form)
 		}
 
-		tmplContent, err := os.ReadFile(path.Join(c.templates, fileinfo.TemplateName))
+		tmplContent, err := os.ReadFile(path.Join(c.templates, templateName))
 		if err != nil {
-			return err
+			return false, err
 		}
-		content, err := ProcessTemplate(tmplContent, cfg.Variables, repoConfig.VarOverrides)
+		overrides, err := c.repoVariables(u, tmplContent)
 		if err != nil {
-			return err
+			return false, err
 		}
+		content, err := ProcessTemplate(tmplContent, c.partials, cfg.Variables, overrides)
+		if err != nil {
+			return false, err
+		}
+		customization := repoConfig.FileCustomizations[file]
+		content = appendContent(content, customization.Append)
 
 		// Ensure that the directory exists
-		repoPath := fmt.Sprintf("%s/%s", repoDir(repoName), fileinfo.RepoPath)
+		repoPath := fmt.Sprintf("%s/%s", u.dir, fileinfo.RepoPath)
+		original, err := os.ReadFile(repoPath)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
 		dir := filepath.Dir(repoPath)
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory: %w", err)
+			return false, fmt.Errorf("failed to create directory: %w", err)
 		}
 
 		err = os.WriteFile(repoPath, content, 0644)
 		if err != nil {
-			return err
+			return false, err
+		}
+
+		if customization.Patch != "" {
+			err = applyPatch(u.dir, customization.Patch, fileinfo.RepoPath)
+			if err != nil {
+				return false, fmt.Errorf("error applying patch %s to %s: %w", customization.Patch, file, err)
+			}
+		}
+
+		if original != nil && preserveYears(cfg.YearModeFor(fileinfo)) {
+			written, err := os.ReadFile(repoPath)
+			if err != nil {
+				return false, err
+			}
+			if OnlyYearsChanged(original, written) {
+				log.Printf(" - Keeping the existing years in %s\n", file)
+				err = os.WriteFile(repoPath, original, 0644)
+				if err != nil {
+					return false, err
+				}
+			}
 		}
 
 		// Stage the changes
 		_, err = w.Add(fileinfo.RepoPath)
 		if err != nil {
-			return err
+			return false, err
 		}
 
-		status, err := w.Status()
+		message := fmt.Sprintf("Update %s", file)
+		if fileinfo.License != "" {
+			// Keep the message license commits have always had, whichever license is managed
+			message = "Update license"
+		}
+		committed, err := c.commitChanges(u, message)
 		if err != nil {
-			return err
+			return false, err
 		}
+		hadChanges = hadChanges || committed
+	}
 
-		if status.IsClean() {
+	return hadChanges, nil
+}
+
+// selectFiles looks up the config for each referenced file and returns the files that should be
+// applied to the repo. Files excluded or protected by the repo config, files whose `when` conditions
+// are not met, and files superseded by another file managing the same path are skipped and recorded
+// in the report. An error is returned if two files would write the same path and the config does
+// not say which one wins.
+func (c *Content) selectFiles(repoName string, files []config.FileRef, cfg *config.Config, repoConfig Config, facts RepoFacts) ([]config.FileRef, error) {
+	var matching []config.FileRef
+	for _, ref := range files {
+		fileinfo := cfg.GetFileInfo(ref.Name)
+		if fileinfo == nil {
+			log.Printf("unknown file %s. Skipping...", ref.Name)
 			continue
 		}
-		hadChanges = true
 
-		var message string
-		if repoConfig.CommitPrefix != nil {
-			// Dereference the pointer to get the string value
-			message = fmt.Sprintf("%s Update %s", *repoConfig.CommitPrefix, file)
-		} else {
-			// Handle the case where PrTargetBranch is nil
-			// For example, use a default message or branch name
-			message = fmt.Sprintf("Update %s", file)
+		if slices.Contains(repoConfig.ExcludeFiles, ref.Name) {
+			log.Printf(" - Skipping %s: excluded by repo config\n", ref.Name)
+			c.report.Add(repoName, ref.Name, StatusSkipped, "excluded by repo config")
+			continue
+		}
+		if repoConfig.isProtected(fileinfo.RepoPath) {
+			reason := fmt.Sprintf("%s is a protected path in repo config", fileinfo.RepoPath)
+			log.Printf(" - Skipping %s: %s\n", ref.Name, reason)
+			c.report.Add(repoName, ref.Name, StatusSkipped, reason)
+			continue
 		}
-		err = c.commit(w, repoName, message)
+
+		matched, reason, err := matchConditions(facts, ref.When, fileinfo.When)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if !matched {
+			log.Printf(" - Skipping %s: %s\n", ref.Name, reason)
+			c.report.Add(repoName, ref.Name, StatusSkipped, reason)
+			continue
 		}
-	}
 
-	repo, _, err := ghDo(func() (*github.Repository, *github.Response, error) {
-		return c.githubClient.Repositories.Get(context.TODO(), c.githubOrg, repoName)
-	})
-	if err != nil {
-		return fmt.Errorf("error getting repo info: %w", err)
+		matching = append(matching, ref)
 	}
 
-	var DefaultBranch string
-	if repoConfig.PrTargetBranch == nil || *repoConfig.PrTargetBranch == "" {
-		DefaultBranch = *repo.DefaultBranch
-	} else {
-		DefaultBranch = *repoConfig.PrTargetBranch
+	kept, superseded, err := cfg.ResolveCollisions(matching)
+	if err != nil {
+		return nil, fmt.Errorf("conflicting files for %s: %w", repoName, err)
 	}
-
-	if hadChanges {
-		return c.pushAndPR(r, repoName, branchName, "Update Managed Files", &pushAndPROptions{
-			PrTargetBranch: &DefaultBranch,
-			AssignUsers:    repoConfig.AssignUsers,
-			AssignGroup:    repoConfig.AssignGroup,
-			BypassPR:       props.BypassPR,
-		})
+	for _, s := range superseded {
+		reason := fmt.Sprintf("superseded by %s", s.By)
+		log.Printf(" - Skipping %s: %s\n", s.Name, reason)
+		c.report.Add(repoName, s.Name, StatusSkipped, reason)
 	}
 
-	return nil
+	return kept, nil
 }
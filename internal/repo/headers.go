@@ -0,0 +1,322 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// generatedMarkerLines is how many lines from the top of a file are checked for generated markers
+const generatedMarkerLines = 20
+
+var yearPattern = regexp.MustCompile(`\b(19|20)[0-9]{2}\b`)
+
+// directivePattern matches the text after a comment prefix for tool directives, such as //go:build,
+// //nolint:errcheck, //export or //line
+var directivePattern = regexp.MustCompile(`^([a-z][a-z0-9]*:\S|(export|extern|line) )`)
+
+// CheckHeaders updates the license headers of source files in the repos matched by the selector
+// that have the manage-headers property set
+func (c *Content) CheckHeaders(cfg *config.Config, sel *Selector) error {
+	headers := cfg.GetHeaders()
+	if headers.TemplateName == "" {
+		return fmt.Errorf("no headers template_name set in the config")
+	}
+
+	return c.forEachRepo(cfg, sel, func(repo *github.RepoCustomPropertyValue) (repoJob, error) {
+		if !manageHeaders(cfg, repo) {
+			return nil, nil
+		}
+		return func(repoName string, props CustomProperties) error {
+			return c.UpdateHeaders(repoName, cfg, props)
+		}, nil
+	})
+}
+
+// manageHeaders returns true if the repo's manage-headers property is set
+func manageHeaders(cfg *config.Config, repo *github.RepoCustomPropertyValue) bool {
+	headersProperty := cfg.GetProperties().ManageHeaders
+	for _, property := range repo.Properties {
+		if property.PropertyName == headersProperty.Name && property.Value != nil && headersProperty.IsTruthy(*property.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateHeaders ensures every matching source file in the repo starts with the current license header
+func (c *Content) UpdateHeaders(repoName string, cfg *config.Config, props CustomProperties) error {
+	plan, err := c.headersPlan(cfg)
+	if err != nil {
+		return err
+	}
+
+	return c.updateRepo(repoName, cfg, props, plan)
+}
+
+// headersPlan returns the plan for the headers command
+func (c *Content) headersPlan(cfg *config.Config) (updatePlan, error) {
+	headers := cfg.GetHeaders()
+	tmplContent, err := os.ReadFile(path.Join(c.templates, headers.TemplateName))
+	if err != nil {
+		return nil, err
+	}
+
+	branchName, err := cfg.BranchName(config.BranchData{Kind: config.BranchKindHeaders})
+	if err != nil {
+		return nil, err
+	}
+
+	return singleBranch(branchName, "Update License Headers", func(u *repoUpdate) (bool, error) {
+		return c.writeHeaders(u, headers, tmplContent, cfg)
+	}), nil
+}
+
+// writeHeaders adds or updates the header of every matching source file in the clone, and commits
+// the changes together. Returns true if anything was committed.
+func (c *Content) writeHeaders(u *repoUpdate, headers config.Headers, tmplContent []byte, cfg *config.Config) (bool, error) {
+	year := currentYear()
+
+	err := filepath.WalkDir(u.dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(u.dir, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !headers.Matches(rel) || u.config.isProtected(rel) {
+			return nil
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		updated, err := ApplyHeader(content, headers.Comments[path.Ext(rel)], headers.GeneratedMarkers, func(startYear string) ([]byte, error) {
+			overrides, err := c.repoVariables(u, tmplContent)
+			if err != nil {
+				return nil, err
+			}
+			overrides["YEAR_RANGE"] = yearRange(startYear, year)
+			return ProcessTemplate(tmplContent, c.partials, cfg.Variables, overrides)
+		})
+		if err != nil {
+			return fmt.Errorf("error rendering header for %s: %w", rel, err)
+		}
+		if bytes.Equal(content, updated) {
+			return nil
+		}
+		if preserveYears(headers.YearMode) && OnlyYearsChanged(content, updated) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filePath, updated, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = u.worktree.Add(rel)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return c.commitChanges(u, "Update license headers")
+}
+
+// ApplyHeader returns the content with its license header replaced by the header from render, commented
+// with the line comment prefix. An existing header is the start of the leading comment, line comments
+// or a /* */ block for // languages, up to its last license line, and must mention a copyright or SPDX
+// identifier. Comments following the header, such as package docs, are kept. render is passed the
+// first year found in the existing header. A shebang or python encoding line is kept at the top of
+// the file. Files containing one of the generated markers near the top are returned unchanged.
+func ApplyHeader(content []byte, prefix string, generatedMarkers []string, render func(startYear string) ([]byte, error)) ([]byte, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+
+	for i, line := range lines {
+		if i >= generatedMarkerLines {
+			break
+		}
+		for _, marker := range generatedMarkers {
+			if strings.Contains(line, marker) {
+				return content, nil
+			}
+		}
+	}
+
+	// Keep lines that must stay at the top of the file
+	var preamble []string
+	for len(lines) > 0 && len(preamble) < 2 {
+		line := lines[0]
+		isShebang := len(preamble) == 0 && strings.HasPrefix(line, "#!")
+		isEncoding := strings.HasPrefix(line, "#") && (strings.Contains(line, "coding:") || strings.Contains(line, "coding="))
+		if !isShebang && !isEncoding {
+			break
+		}
+		preamble = append(preamble, line)
+		lines = lines[1:]
+	}
+
+	startYear := ""
+	if end, rest := existingHeader(lines, prefix); end > 0 {
+		startYear = yearPattern.FindString(strings.Join(lines[:end], ""))
+		lines = append(rest, lines[end:]...)
+	}
+
+	// Drop blank lines between the header and the rest of the file
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+
+	header, err := render(startYear)
+	if err != nil {
+		return nil, err
+	}
+
+	var result strings.Builder
+	for _, line := range preamble {
+		result.WriteString(line)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(header), "\n"), "\n") {
+		if line == "" {
+			result.WriteString(prefix + "\n")
+			continue
+		}
+		result.WriteString(prefix + " " + line + "\n")
+	}
+	if len(lines) > 0 {
+		result.WriteString("\n")
+		for _, line := range lines {
+			result.WriteString(line)
+		}
+	}
+
+	return []byte(result.String()), nil
+}
+
+// licenseWords mark a comment line as part of a license header
+var licenseWords = []string{"copyright", "spdx-license-identifier", "license", "licence", "warranty", "rights reserved"}
+
+// existingHeader returns how many of the leading lines hold an existing license header, or 0 if
+// there is none. When the header only covers part of a block comment, rest holds the lines that
+// reopen the block, so the remainder of the comment is kept.
+func existingHeader(lines []string, prefix string) (int, []string) {
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	first := strings.TrimSpace(lines[0])
+	if prefix == "//" && strings.HasPrefix(first, "/*") {
+		closing := slices.IndexFunc(lines, func(line string) bool { return strings.Contains(line, "*/") })
+		if closing == -1 {
+			return 0, nil
+		}
+		var text []string
+		for _, line := range lines[:closing+1] {
+			line = strings.TrimSpace(line)
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "/**"), "/*")
+			line = strings.TrimSuffix(line, "*/")
+			text = append(text, strings.TrimPrefix(strings.TrimSpace(line), "*"))
+		}
+		end := headerEnd(text)
+		if end == 0 {
+			return 0, nil
+		}
+		// Skip blank lines left between the header and the rest of the block
+		for end <= closing && strings.TrimSpace(text[end]) == "" {
+			end++
+		}
+		if end > closing {
+			return closing + 1, nil
+		}
+		opener := "/*"
+		if strings.HasPrefix(first, "/**") {
+			opener = "/**"
+		}
+		return end, []string{opener + "\n"}
+	}
+
+	// Directives, such as //go:build, end the comment
+	var text []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, prefix) || directivePattern.MatchString(strings.TrimPrefix(line, prefix)) {
+			break
+		}
+		text = append(text, strings.TrimPrefix(line, prefix))
+	}
+	end := headerEnd(text)
+	// Drop empty comment lines left between the header and the rest of the comment
+	for end > 0 && end < len(text) && strings.TrimSpace(text[end]) == "" {
+		end++
+	}
+	return end, nil
+}
+
+// headerEnd returns how many of the comment lines, with the comment syntax removed, belong to the
+// license header. Paragraphs are separated by empty lines, and the header ends at the last license
+// line of the leading paragraphs that have one, so a package doc that follows is not part of it.
+// The header must mention a copyright or SPDX identifier.
+func headerEnd(text []string) int {
+	end := 0
+	start := 0
+	for start < len(text) {
+		for start < len(text) && strings.TrimSpace(text[start]) == "" {
+			start++
+		}
+		stop := start
+		for stop < len(text) && strings.TrimSpace(text[stop]) != "" {
+			stop++
+		}
+
+		last := -1
+		for i := start; i < stop; i++ {
+			lower := strings.ToLower(text[i])
+			if slices.ContainsFunc(licenseWords, func(word string) bool { return strings.Contains(lower, word) }) {
+				last = i
+			}
+		}
+		if last == -1 {
+			break
+		}
+		end = last + 1
+		if end < stop {
+			break
+		}
+		start = stop
+	}
+
+	header := strings.ToLower(strings.Join(text[:end], "\n"))
+	if !strings.Contains(header, "copyright") && !strings.Contains(header, "spdx-license-identifier") {
+		return 0
+	}
+	return end
+}
@@ -0,0 +1,112 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestApplyHeader(t *testing.T) {
+	markers := []string{"Code generated", "DO NOT EDIT"}
+	render := func(startYear string) ([]byte, error) {
+		years := "2024"
+		if startYear != "" {
+			years = startYear + "-2024"
+		}
+		return []byte("Copyright " + years + " Chia Network Inc.\nSPDX-License-Identifier: Apache-2.0\n"), nil
+	}
+
+	tests := []struct {
+		name     string
+		prefix   string
+		content  string
+		expected string
+	}{
+		{
+			name:     "adds header",
+			prefix:   "//",
+			content:  "package main\n",
+			expected: "// Copyright 2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\npackage main\n",
+		},
+		{
+			name:     "updates year range",
+			prefix:   "//",
+			content:  "// Copyright 2021 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\npackage main\n",
+			expected: "// Copyright 2021-2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\npackage main\n",
+		},
+		{
+			name:     "keeps build constraints and package docs",
+			prefix:   "//",
+			content:  "//go:build linux\n\n// Package main does things\npackage main\n",
+			expected: "// Copyright 2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\n//go:build linux\n\n// Package main does things\npackage main\n",
+		},
+		{
+			name:     "replaces headers without a space after the prefix",
+			prefix:   "//",
+			content:  "//Copyright 2020 Chia Network Inc.\n//go:build linux\n\npackage main\n",
+			expected: "// Copyright 2020-2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\n//go:build linux\n\npackage main\n",
+		},
+		{
+			name:     "replaces hash headers without a space after the prefix",
+			prefix:   "#",
+			content:  "#Copyright 2019 Chia Network Inc.\n\nprint('hi')\n",
+			expected: "# Copyright 2019-2024 Chia Network Inc.\n# SPDX-License-Identifier: Apache-2.0\n\nprint('hi')\n",
+		},
+		{
+			name:     "keeps shebang first",
+			prefix:   "#",
+			content:  "#!/usr/bin/env python3\n# Copyright 2022 Chia Network Inc.\n\nprint('hi')\n",
+			expected: "#!/usr/bin/env python3\n# Copyright 2022-2024 Chia Network Inc.\n# SPDX-License-Identifier: Apache-2.0\n\nprint('hi')\n",
+		},
+		{
+			name:     "keeps package docs directly after the header",
+			prefix:   "//",
+			content:  "// Copyright 2020 Chia Network Inc.\n// Package foo does things\npackage foo\n",
+			expected: "// Copyright 2020-2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\n// Package foo does things\npackage foo\n",
+		},
+		{
+			name:     "keeps package docs in a later paragraph",
+			prefix:   "//",
+			content:  "// Copyright 2020 Chia Network Inc.\n//\n// Licensed under the Apache License, Version 2.0\n//\n// Package foo does things\npackage foo\n",
+			expected: "// Copyright 2020-2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\n// Package foo does things\npackage foo\n",
+		},
+		{
+			name:     "replaces block comment headers",
+			prefix:   "//",
+			content:  "/*\n * Copyright 2019 Chia Network Inc.\n * SPDX-License-Identifier: Apache-2.0\n */\n\nexport const a = 1;\n",
+			expected: "// Copyright 2019-2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\nexport const a = 1;\n",
+		},
+		{
+			name:     "replaces single line block comment headers",
+			prefix:   "//",
+			content:  "/* Copyright 2019 Chia Network Inc. */\nfn main() {}\n",
+			expected: "// Copyright 2019-2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\nfn main() {}\n",
+		},
+		{
+			name:     "keeps docs after the header in a block comment",
+			prefix:   "//",
+			content:  "/**\n * Copyright 2019 Chia Network Inc.\n *\n * Helpers for the wallet.\n */\nexport const a = 1;\n",
+			expected: "// Copyright 2019-2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\n/**\n * Helpers for the wallet.\n */\nexport const a = 1;\n",
+		},
+		{
+			name:     "keeps block comments without a copyright",
+			prefix:   "//",
+			content:  "/* Helpers for the wallet. */\nexport const a = 1;\n",
+			expected: "// Copyright 2024 Chia Network Inc.\n// SPDX-License-Identifier: Apache-2.0\n\n/* Helpers for the wallet. */\nexport const a = 1;\n",
+		},
+		{
+			name:     "skips generated files",
+			prefix:   "//",
+			content:  "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage pb\n",
+			expected: "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage pb\n",
+		},
+	}
+
+	for _, test := range tests {
+		result, err := repo.ApplyHeader([]byte(test.content), test.prefix, markers, render)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expected, string(result), test.name)
+	}
+}
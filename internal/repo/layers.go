@@ -0,0 +1,382 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/spf13/viper"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+const (
+	// LayerOrg is the name of the org-wide defaults layer
+	LayerOrg = "org"
+
+	// LayerRepo is the name of the layer loaded from the repo's own config file
+	LayerRepo = "repo"
+
+	// LayerProperties is the name of the layer built from custom properties
+	LayerProperties = "properties"
+
+	// defaultsDir is the directory in the defaults repo holding org and team layers
+	defaultsDir = "repo-content-updater"
+)
+
+// ConfigLayer is repo config from a single source, such as org defaults or the repo itself
+type ConfigLayer struct {
+	Name   string
+	Config Config
+}
+
+// ResolvedConfig is repo config merged from every layer, along with the layer each value came from.
+// Sources is keyed by the yaml key, or by key.name for individual entries of a map such as var_overrides.
+type ResolvedConfig struct {
+	Config
+	Sources map[string]string
+}
+
+// ResolvedValue is a single value from a ResolvedConfig, formatted for display
+type ResolvedValue struct {
+	Key   string
+	Value string
+	Layer string
+}
+
+// MergeConfigLayers merges the layers in order, with later layers taking precedence. Any value set
+// in a layer replaces the value from earlier layers, except maps, which are merged key by key.
+func MergeConfigLayers(layers ...ConfigLayer) ResolvedConfig {
+	resolved := ResolvedConfig{Sources: map[string]string{}}
+	dst := reflect.ValueOf(&resolved.Config).Elem()
+
+	for _, layer := range layers {
+		src := reflect.ValueOf(layer.Config)
+		for i := range src.NumField() {
+			field := src.Field(i)
+			if field.IsZero() {
+				continue
+			}
+			key := configKey(src.Type().Field(i))
+
+			if field.Kind() != reflect.Map {
+				dst.Field(i).Set(field)
+				resolved.Sources[key] = layer.Name
+				continue
+			}
+
+			if dst.Field(i).IsNil() {
+				dst.Field(i).Set(reflect.MakeMap(field.Type()))
+			}
+			iter := field.MapRange()
+			for iter.Next() {
+				dst.Field(i).SetMapIndex(iter.Key(), iter.Value())
+				resolved.Sources[fmt.Sprintf("%s.%v", key, iter.Key())] = layer.Name
+			}
+		}
+	}
+
+	return resolved
+}
+
+// Values returns every value set in the resolved config in field order, with map entries sorted by key
+func (r ResolvedConfig) Values() []ResolvedValue {
+	var values []ResolvedValue
+	v := reflect.ValueOf(r.Config)
+	for i := range v.NumField() {
+		field := v.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		key := configKey(v.Type().Field(i))
+
+		if field.Kind() != reflect.Map {
+			values = append(values, ResolvedValue{Key: key, Value: formatValue(field), Layer: r.Sources[key]})
+			continue
+		}
+
+		mapKeys := field.MapKeys()
+		sort.Slice(mapKeys, func(a, b int) bool {
+			return fmt.Sprint(mapKeys[a]) < fmt.Sprint(mapKeys[b])
+		})
+		for _, mapKey := range mapKeys {
+			entryKey := fmt.Sprintf("%s.%v", key, mapKey)
+			values = append(values, ResolvedValue{Key: entryKey, Value: formatValue(field.MapIndex(mapKey)), Layer: r.Sources[entryKey]})
+		}
+	}
+
+	return values
+}
+
+func configKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return key
+}
+
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Pointer:
+		return formatValue(v.Elem())
+	case reflect.Slice:
+		var items []string
+		for i := range v.Len() {
+			items = append(items, formatValue(v.Index(i)))
+		}
+		return strings.Join(items, ", ")
+	case reflect.Struct:
+		return fmt.Sprintf("%+v", v.Interface())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// ResolveRepoConfig merges the org defaults, the config for each team that owns the repo, values
+// mapped from custom properties, and the repo's own config. Org and team layers are read from the
+// defaults repo (--defaults-repo) in the org, from repo-content-updater/defaults.yaml and
+// repo-content-updater/teams/<team-slug>.yaml. Custom properties are applied before the repo's
+// own config unless property_precedence is set to property, in which case they are applied last.
+func (c *Content) ResolveRepoConfig(repoName string, repoConfig Config, cfg *config.Config, props CustomProperties) (ResolvedConfig, error) {
+	layers, err := c.orgAndTeamLayers(repoName)
+	if err != nil {
+		return ResolvedConfig{}, err
+	}
+
+	propertiesLayer, err := PropertiesLayer(cfg.PropertyMappings, props)
+	if err != nil {
+		return ResolvedConfig{}, err
+	}
+	repoLayer := ConfigLayer{Name: LayerRepo, Config: repoConfig}
+
+	if cfg.PropertyPrecedence == config.PropertyPrecedenceProperty {
+		layers = append(layers, repoLayer, propertiesLayer)
+	} else {
+		layers = append(layers, propertiesLayer, repoLayer)
+	}
+
+	return MergeConfigLayers(layers...), nil
+}
+
+// PropertiesLayer builds a config layer from the custom properties set on a repo, using the
+// property mappings from the config. List keys, such as assign_users, are comma separated, and map
+// keys, such as var_overrides, are comma separated name=value pairs.
+func PropertiesLayer(mappings []config.PropertyMapping, props CustomProperties) (ConfigLayer, error) {
+	layer := ConfigLayer{Name: LayerProperties}
+	for _, mapping := range mappings {
+		value, ok := props.Values[mapping.Property]
+		if !ok || value == "" {
+			continue
+		}
+
+		if mapping.Variable != "" {
+			if layer.Config.VarOverrides == nil {
+				layer.Config.VarOverrides = map[string]string{}
+			}
+			layer.Config.VarOverrides[mapping.Variable] = value
+			continue
+		}
+
+		if err := setConfigKey(&layer.Config, mapping.Key, value); err != nil {
+			return ConfigLayer{}, fmt.Errorf("error mapping property %s: %w", mapping.Property, err)
+		}
+	}
+
+	return layer, nil
+}
+
+// ValidatePropertyMappings ensures every property mapping refers to a repo config key that can be set from a property
+func ValidatePropertyMappings(mappings []config.PropertyMapping) error {
+	var errs []error
+	for _, mapping := range mappings {
+		if mapping.Key == "" {
+			continue
+		}
+		if err := setConfigKey(&Config{}, mapping.Key, "name=value"); err != nil {
+			errs = append(errs, fmt.Errorf("property mapping for %q: %w", mapping.Property, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setConfigKey sets the config field with the given yaml key from a property value
+func setConfigKey(cfg *Config, key, value string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := range v.NumField() {
+		if configKey(v.Type().Field(i)) != key {
+			continue
+		}
+
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.String:
+			field.Set(reflect.ValueOf(&value))
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			field.Set(reflect.ValueOf(splitList(value)))
+		case field.Kind() == reflect.Map && field.Type().Elem().Kind() == reflect.String:
+			// Merge into any existing entries, which may have been set by variable mappings
+			if field.IsNil() {
+				field.Set(reflect.MakeMap(field.Type()))
+			}
+			for _, entry := range splitList(value) {
+				name, entryValue, ok := strings.Cut(entry, "=")
+				if !ok {
+					return fmt.Errorf("expected name=value entries for %s, got %q", key, entry)
+				}
+				field.SetMapIndex(reflect.ValueOf(strings.TrimSpace(name)), reflect.ValueOf(strings.TrimSpace(entryValue)))
+			}
+		default:
+			return fmt.Errorf("%s cannot be set from a custom property", key)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown repo config key %s", key)
+}
+
+// splitList splits a comma separated list, trimming whitespace and dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// orgAndTeamLayers returns the org layer followed by a layer for each team that owns the repo,
+// skipping any that are not defined
+func (c *Content) orgAndTeamLayers(repoName string) ([]ConfigLayer, error) {
+	defaultsRepo := viper.GetString("defaults-repo")
+	if defaultsRepo == "" {
+		return nil, nil
+	}
+
+	var layers []ConfigLayer
+	orgConfig, found, err := c.fetchConfigFile(defaultsRepo, fmt.Sprintf("%s/defaults.yaml", defaultsDir))
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		layers = append(layers, ConfigLayer{Name: LayerOrg, Config: orgConfig})
+	}
+
+	teams, err := c.owningTeams(repoName)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range teams {
+		teamConfig, found, err := c.fetchConfigFile(defaultsRepo, fmt.Sprintf("%s/teams/%s.yaml", defaultsDir, team))
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			layers = append(layers, ConfigLayer{Name: fmt.Sprintf("team:%s", team), Config: teamConfig})
+		}
+	}
+
+	return layers, nil
+}
+
+// FetchRepoConfig reads the repo's own config file through the API, for use without a clone
+func (c *Content) FetchRepoConfig(repoName string) (Config, error) {
+	for _, name := range []string{".repo-content-updater.yaml", ".repo-content-updater.yml"} {
+		repoConfig, found, err := c.fetchFile(repoName, name)
+		if err != nil || found {
+			return repoConfig, err
+		}
+	}
+
+	return Config{}, nil
+}
+
+// fetchConfigFile reads repo config from a file in the defaults repo. Files are cached for the
+// run, since the same org and team layers apply to many repos.
+func (c *Content) fetchConfigFile(repoName, path string) (Config, bool, error) {
+	key := fmt.Sprintf("%s/%s", repoName, path)
+	if cached, ok := c.layerCache[key]; ok {
+		return cached.config, cached.found, nil
+	}
+
+	repoConfig, found, err := c.fetchFile(repoName, path)
+	if err != nil {
+		return Config{}, false, err
+	}
+	c.layerCache[key] = cachedLayer{config: repoConfig, found: found}
+
+	return repoConfig, found, nil
+}
+
+// fetchFile reads, strictly parses and validates repo config from a file in the given repo through the API
+func (c *Content) fetchFile(repoName, path string) (Config, bool, error) {
+	file, resp, err := ghDo(func() (*github.RepositoryContent, *github.Response, error) {
+		file, _, resp, err := c.githubClient.Repositories.GetContents(context.TODO(), c.githubOrg, repoName, path, nil)
+		return file, resp, err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return Config{}, false, nil
+		}
+		return Config{}, false, fmt.Errorf("error fetching %s from %s: %w", path, repoName, err)
+	}
+	if file == nil {
+		return Config{}, false, nil
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return Config{}, false, err
+	}
+	repoConfig, err := ParseRepoConfig([]byte(content))
+	if err == nil {
+		err = repoConfig.validateValues()
+	}
+	if err != nil {
+		return Config{}, false, fmt.Errorf("invalid config in %s/%s: %w", repoName, path, err)
+	}
+
+	return repoConfig, true, nil
+}
+
+// owningTeams returns the slugs of teams with admin or maintain access to the repo, sorted by name
+func (c *Content) owningTeams(repoName string) ([]string, error) {
+	var teams []string
+
+	opts := &github.ListOptions{
+		Page:    0,
+		PerPage: 100,
+	}
+	for {
+		opts.Page++
+		result, resp, err := ghDo(func() ([]*github.Team, *github.Response, error) {
+			return c.githubClient.Repositories.ListTeams(context.TODO(), c.githubOrg, repoName, opts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing teams for %s: %w", repoName, err)
+		}
+
+		for _, team := range result {
+			permissions := team.GetPermissions()
+			if permissions["admin"] || permissions["maintain"] || slices.Contains([]string{"admin", "maintain"}, team.GetPermission()) {
+				teams = append(teams, team.GetSlug())
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	sort.Strings(teams)
+	return slices.Compact(teams), nil
+}
+
+type cachedLayer struct {
+	config Config
+	found  bool
+}
@@ -0,0 +1,80 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestMergeConfigLayers(t *testing.T) {
+	orgBranch := "main"
+	teamPrefix := "[infra]"
+	repoBranch := "develop"
+
+	resolved := repo.MergeConfigLayers(
+		repo.ConfigLayer{Name: repo.LayerOrg, Config: repo.Config{
+			PrTargetBranch: &orgBranch,
+			AssignUsers:    []string{"org-user"},
+			VarOverrides:   map[string]string{"CGO_ENABLED": "0", "COMPANY_NAME": "Org"},
+		}},
+		repo.ConfigLayer{Name: "team:infra", Config: repo.Config{
+			CommitPrefix: &teamPrefix,
+			VarOverrides: map[string]string{"CGO_ENABLED": "1"},
+		}},
+		repo.ConfigLayer{Name: repo.LayerRepo, Config: repo.Config{
+			PrTargetBranch: &repoBranch,
+		}},
+	)
+
+	assert.Equal(t, "develop", *resolved.PrTargetBranch)
+	assert.Equal(t, "[infra]", *resolved.CommitPrefix)
+	assert.Equal(t, []string{"org-user"}, resolved.AssignUsers)
+	assert.Equal(t, map[string]string{"CGO_ENABLED": "1", "COMPANY_NAME": "Org"}, resolved.VarOverrides)
+
+	assert.Equal(t, []repo.ResolvedValue{
+		{Key: "pr_target_branch", Value: "develop", Layer: repo.LayerRepo},
+		{Key: "assign_users", Value: "org-user", Layer: repo.LayerOrg},
+		{Key: "commit_prefix", Value: "[infra]", Layer: "team:infra"},
+		{Key: "var_overrides.CGO_ENABLED", Value: "1", Layer: "team:infra"},
+		{Key: "var_overrides.COMPANY_NAME", Value: "Org", Layer: repo.LayerOrg},
+	}, resolved.Values())
+}
+
+func TestPropertiesLayer(t *testing.T) {
+	mappings := []config.PropertyMapping{
+		{Property: "rcu-target-branch", Key: "pr_target_branch"},
+		{Property: "rcu-reviewers", Key: "assign_users"},
+		{Property: "rcu-cgo", Variable: "CGO_ENABLED"},
+		{Property: "rcu-vars", Key: "var_overrides"},
+		{Property: "rcu-unset", Key: "commit_prefix"},
+	}
+	props := repo.CustomProperties{Values: map[string]string{
+		"rcu-target-branch": "develop",
+		"rcu-reviewers":     "alice, bob",
+		"rcu-vars":          "COMPANY_NAME=Org, DEPENDABOT_GOMOD_DIRECTORY=/src",
+		"rcu-cgo":           "1",
+	}}
+
+	layer, err := repo.PropertiesLayer(mappings, props)
+	assert.Nil(t, err)
+	assert.Equal(t, repo.LayerProperties, layer.Name)
+	assert.Equal(t, "develop", *layer.Config.PrTargetBranch)
+	assert.Equal(t, []string{"alice", "bob"}, layer.Config.AssignUsers)
+	assert.Nil(t, layer.Config.CommitPrefix)
+	assert.Equal(t, map[string]string{
+		"COMPANY_NAME":               "Org",
+		"DEPENDABOT_GOMOD_DIRECTORY": "/src",
+		"CGO_ENABLED":                "1",
+	}, layer.Config.VarOverrides)
+
+	assert.Nil(t, repo.ValidatePropertyMappings(mappings))
+	assert.ErrorContains(t, repo.ValidatePropertyMappings([]config.PropertyMapping{
+		{Property: "rcu-typo", Key: "pr_target_brnach"},
+	}), "unknown repo config key pr_target_brnach")
+	assert.ErrorContains(t, repo.ValidatePropertyMappings([]config.PropertyMapping{
+		{Property: "rcu-customizations", Key: "file_customizations"},
+	}), "file_customizations cannot be set from a custom property")
+}
@@ -1,12 +1,9 @@
 package repo
 
 import (
-	"context"
-	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path"
+	"slices"
 	"strings"
 
 	"github.com/google/go-github/v59/github"
@@ -14,162 +11,55 @@ import (
 	"github.com/chia-network/repo-content-updater/internal/config"
 )
 
-// CheckLicenses checks all repos for licenses that need to be managed/updated
-func (c *Content) CheckLicenses(cfg *config.Config, onlyRepo string) error {
-	reposToCheck := map[string]CustomProperties{}
-
-	opts := &github.ListOptions{
-		Page:    0,
-		PerPage: 100,
-	}
-	for {
-		opts.Page++
-		result, resp, err := ghDo(func() ([]*github.RepoCustomPropertyValue, *github.Response, error) {
-			return c.githubClient.Organizations.ListCustomPropertyValues(context.TODO(), c.githubOrg, opts)
-		})
-		if err != nil {
-			return err
+// CheckLicenses checks the repos matched by the selector for licenses that need to be managed/updated
+func (c *Content) CheckLicenses(cfg *config.Config, sel *Selector) error {
+	return c.forEachRepo(cfg, sel, func(repo *github.RepoCustomPropertyValue) (repoJob, error) {
+		license := c.licenseFor(cfg, repo)
+		if license == nil {
+			return nil, nil
 		}
+		return func(repoName string, props CustomProperties) error {
+			return c.UpdateLicense(repoName, license, cfg, props)
+		}, nil
+	})
+}
 
-		for _, repo := range result {
-			if onlyRepo != "" && !strings.EqualFold(repo.RepositoryName, onlyRepo) {
-				continue
-			}
-			manageLicense := false
-			for _, property := range repo.Properties {
-				if property.PropertyName == "manage-license" && property.Value != nil && *property.Value == "yes" {
-					manageLicense = true
-				}
-			}
-			if manageLicense {
-				reposToCheck[repo.RepositoryName] = parseCustomProperties(repo.Properties)
-			}
+// licenseFor returns the license file selected by the repo's manage-license property, or nil if the
+// license is not managed. A value that selects no license file, such as a typo in the license id, is
+// recorded as skipped in the report, so the repo does not silently stop being managed.
+func (c *Content) licenseFor(cfg *config.Config, repo *github.RepoCustomPropertyValue) *config.File {
+	licenseProperty := cfg.GetProperties().ManageLicense
+	for _, property := range repo.Properties {
+		if property.PropertyName != licenseProperty.Name || property.Value == nil || *property.Value == "" {
+			continue
 		}
-
-		if resp.NextPage == 0 {
-			break
+		license := cfg.ResolveLicense(*property.Value)
+		if license != nil {
+			return license
 		}
-	}
 
-	for repo, props := range reposToCheck {
-		log.Printf("Need to check %s\n", repo)
-		err := c.UpdateLicense(repo, cfg, props)
-		if err != nil {
-			log.Printf("Error updating %s: %s\n", repo, err.Error())
-			continue
+		var reason string
+		switch {
+		case licenseProperty.IsTruthy(*property.Value):
+			reason = fmt.Sprintf("no file for default license %s", cfg.GetDefaultLicense())
+		case slices.Contains([]string{"no", "false"}, strings.ToLower(*property.Value)):
+			return nil
+		default:
+			reason = fmt.Sprintf("%s %q is not a configured license", licenseProperty.Name, *property.Value)
 		}
+		log.Printf("Skipping license for %s: %s\n", repo.RepositoryName, reason)
+		c.report.Add(repo.RepositoryName, "", StatusSkipped, reason)
+		return nil
 	}
-
 	return nil
 }
 
-// UpdateLicense ensures the license is up to date for the given repo
-func (c *Content) UpdateLicense(repoName string, cfg *config.Config, props CustomProperties) error {
-	defer removeDirIfExists(repoDir(repoName))
-
-	r, w, err := c.cloneRepo(repoName)
-	if err != nil {
-		return err
-	}
-
-	repoConfig, err := c.LoadRepoConfig(repoDir(repoName))
-	if err != nil {
-		log.Printf("Error loading config for %s: %v\n", repoName, err)
-	}
-
-	headRef, err := r.Head()
-	if err != nil {
-		return fmt.Errorf("error getting head ref for %s: %w", repoName, err)
-	}
-	headRefName := headRef.Name()
-	if !headRefName.IsBranch() {
-		return errors.New("HEAD ref is not a branch")
-	}
-	defaultBranch := headRefName.Short()
-
-	// If we are targeting a different branch with PRs, then our base also needs to start from that branch
-	if repoConfig.PrTargetBranch != nil && *repoConfig.PrTargetBranch != defaultBranch {
-		err = c.checkoutBranch(r, w, *repoConfig.PrTargetBranch)
-		if err != nil {
-			return fmt.Errorf("error checking out branch %s: %w", *repoConfig.PrTargetBranch, err)
-		}
-	}
-
-	file, err := os.ReadFile(path.Join(c.templates, "LICENSE"))
-	if err != nil {
-		return err
-	}
-	content, err := ProcessTemplate(file, cfg.Variables, repoConfig.VarOverrides)
-	if err != nil {
-		return err
-	}
-
-	branchName := "update-license"
-	err = c.createBranch(r, w, branchName)
-	if err != nil {
-		return err
-	}
-
-	// To be more consistent, we delete alternate forms of the LICENSE first
-	// then write the LICENSE file
-	// If similar enough, the commit should see a rename with minor changes
-	alternateForms := []string{"LICENSE_APACHE", "LICENSE.txt", "LICENSE.md", "license-apache", "License"}
-	for _, form := range alternateForms {
-		// Ignoring errors since these files may not exist
-		_ = os.Remove(fmt.Sprintf("%s/%s", repoDir(repoName), form))
-	}
-
-	err = os.WriteFile(fmt.Sprintf("%s/LICENSE", repoDir(repoName)), content, 0644)
-	if err != nil {
-		return err
-	}
-
-	// Stage the changes
-	_, err = w.Add("LICENSE")
-	if err != nil {
-		return err
-	}
-
-	status, err := w.Status()
-	if err != nil {
-		return err
-	}
-
-	if status.IsClean() {
-		return nil
-	}
-
-	var message string
-	if repoConfig.CommitPrefix != nil {
-		message = fmt.Sprintf("%s Update license", *repoConfig.CommitPrefix)
-	} else {
-		// Handle the case where CommitPrefix is nil
-		// For example, use a default message
-		message = "Update license"
-	}
-	err = c.commit(w, repoName, message)
-	if err != nil {
-		return err
-	}
-
-	repo, _, err := ghDo(func() (*github.Repository, *github.Response, error) {
-		return c.githubClient.Repositories.Get(context.TODO(), c.githubOrg, repoName)
-	})
-	if err != nil {
-		return fmt.Errorf("error getting repo info: %w", err)
-	}
-
-	var DefaultBranch string
-	if repoConfig.PrTargetBranch == nil || *repoConfig.PrTargetBranch == "" {
-		DefaultBranch = *repo.DefaultBranch
-	} else {
-		DefaultBranch = *repoConfig.PrTargetBranch
-	}
+// UpdateLicense ensures the given license file is up to date for the given repo
+func (c *Content) UpdateLicense(repoName string, license *config.File, cfg *config.Config, props CustomProperties) error {
+	return c.updateRepo(repoName, cfg, props, c.licensePlan(license, cfg))
+}
 
-	return c.pushAndPR(r, repoName, branchName, "Updated License", &pushAndPROptions{
-		PrTargetBranch: &DefaultBranch,
-		AssignUsers:    repoConfig.AssignUsers,
-		AssignGroup:    repoConfig.AssignGroup,
-		BypassPR:       props.BypassPR,
-	})
+// licensePlan returns the plan for the license command, which always opens a single PR
+func (c *Content) licensePlan(license *config.File, cfg *config.Config) updatePlan {
+	return c.planFiles([]config.FileRef{{Name: license.Name}}, cfg, config.BranchKindLicense, "Updated License", false)
 }
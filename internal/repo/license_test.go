@@ -0,0 +1,37 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestLicenseFor(t *testing.T) {
+	cfg := &config.Config{Files: []config.File{
+		{Name: "license-apache-2.0", License: "apache-2.0", RepoPath: "LICENSE"},
+	}}
+	repoWith := func(value string) *github.RepoCustomPropertyValue {
+		return &github.RepoCustomPropertyValue{
+			RepositoryName: "test-repo",
+			Properties:     []*github.CustomPropertyValue{{PropertyName: "manage-license", Value: github.String(value)}},
+		}
+	}
+
+	license, report := repo.LicenseFor(cfg, repoWith("yes"))
+	assert.Equal(t, "license-apache-2.0", license.Name)
+	assert.Empty(t, report.Entries())
+
+	license, report = repo.LicenseFor(cfg, repoWith("no"))
+	assert.Nil(t, license)
+	assert.Empty(t, report.Entries())
+
+	license, report = repo.LicenseFor(cfg, repoWith("apache2"))
+	assert.Nil(t, license)
+	assert.Equal(t, []repo.ReportEntry{
+		{Repo: "test-repo", Status: repo.StatusSkipped, Reason: `manage-license "apache2" is not a configured license`},
+	}, report.Entries())
+}
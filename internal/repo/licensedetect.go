@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// licenseSignature identifies a license by phrases that must all appear in the normalized license text
+type licenseSignature struct {
+	spdx    string
+	phrases []string
+}
+
+// licenseSignatures are checked in order, so licenses whose text names other licenses must come
+// first, such as the MPL which names the GPL family as secondary licenses
+var licenseSignatures = []licenseSignature{
+	{"Apache-2.0", []string{"apache license", "version 2 0"}},
+	{"MPL-2.0", []string{"mozilla public license version 2 0"}},
+	{"AGPL-3.0", []string{"gnu affero general public license version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license version 2 1"}},
+	{"GPL-3.0", []string{"gnu general public license version 3"}},
+	{"GPL-2.0", []string{"gnu general public license version 2"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted"}},
+	{"MIT", []string{"permission is hereby granted free of charge to any person obtaining a copy", "the above copyright notice and this permission notice shall be included"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ClassifyLicense returns the SPDX identifier of the license text, such as Apache-2.0 or MIT, or an
+// empty string if the license is not recognized. Matching is based on distinctive phrases, ignoring
+// case, punctuation and line wrapping, so copyright lines and formatting differences do not matter.
+func ClassifyLicense(content []byte) string {
+	text := " " + strings.TrimSpace(nonAlphanumeric.ReplaceAllString(strings.ToLower(string(content)), " ")) + " "
+
+	for _, signature := range licenseSignatures {
+		matched := true
+		for _, phrase := range signature.phrases {
+			if !strings.Contains(text, " "+phrase+" ") {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return signature.spdx
+		}
+	}
+
+	return ""
+}
+
+// SameLicenseFamily returns true if both license identifiers are the same license, ignoring case and
+// the -only and -or-later suffixes, so GPL-3.0-only and gpl-3.0 are the same family. Different versions
+// of a license are different families, since moving between them is a relicense.
+func SameLicenseFamily(a, b string) bool {
+	return a != "" && licenseFamily(a) == licenseFamily(b)
+}
+
+func licenseFamily(license string) string {
+	license = strings.ToLower(strings.TrimSpace(license))
+	license = strings.TrimSuffix(license, "+")
+	license = strings.TrimSuffix(license, "-only")
+	license = strings.TrimSuffix(license, "-or-later")
+	return license
+}
+
+// checkExistingLicense classifies every license file the managed license would replace, and returns
+// a reason if any of them is not the same license family, so the repo can be flagged for legal review
+// instead of being relicensed. An empty reason means the license can be replaced.
+func checkExistingLicense(dir string, license *config.File) (string, error) {
+	for _, licensePath := range append([]string{license.RepoPath}, license.AlternatePaths...) {
+		content, err := os.ReadFile(filepath.Join(dir, licensePath))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+
+		existing := ClassifyLicense(content)
+		if existing == "" {
+			return fmt.Sprintf("existing %s is not a recognized license, managed license is %s", licensePath, license.License), nil
+		}
+		if !SameLicenseFamily(existing, license.License) {
+			return fmt.Sprintf("existing %s is %s, managed license is %s", licensePath, existing, license.License), nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,42 @@
+package repo_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestClassifyLicense(t *testing.T) {
+	for templateName, expected := range map[string]string{
+		"LICENSE":     "Apache-2.0",
+		"LICENSE-MIT": "MIT",
+	} {
+		content, err := os.ReadFile("../../templates/" + templateName)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, repo.ClassifyLicense(content), templateName)
+	}
+
+	tests := map[string]string{
+		"Copyright (c) 2020, Someone\nAll rights reserved.\n\nRedistribution and use in source and binary forms, with or without\nmodification, are permitted provided that the following conditions are met:\n\n3. Neither the name of the copyright holder nor the names of its\n   contributors may be used": "BSD-3-Clause",
+		"                    GNU GENERAL PUBLIC LICENSE\n                       Version 3, 29 June 2007\n\n13. Use with the GNU Affero General Public License.":                                                                                                                                                 "GPL-3.0",
+		"                    GNU AFFERO GENERAL PUBLIC LICENSE\n                       Version 3, 19 November 2007":                                                                                                                                                                                             "AGPL-3.0",
+		"Mozilla Public License Version 2.0\n\n1.12. \"Secondary License\" means either the GNU General Public License, Version 2.0, the GNU Lesser General Public License, Version 2.1, the GNU Affero General Public License, Version 3.0":                                                                    "MPL-2.0",
+		"This is free and unencumbered software released into the public domain.": "Unlicense",
+		"All rights reserved. Do not copy.":                                       "",
+	}
+	for content, expected := range tests {
+		assert.Equal(t, expected, repo.ClassifyLicense([]byte(content)), content)
+	}
+}
+
+func TestSameLicenseFamily(t *testing.T) {
+	assert.True(t, repo.SameLicenseFamily("Apache-2.0", "apache-2.0"))
+	assert.True(t, repo.SameLicenseFamily("GPL-3.0", "GPL-3.0-or-later"))
+	assert.True(t, repo.SameLicenseFamily("GPL-3.0-only", "gpl-3.0"))
+	assert.False(t, repo.SameLicenseFamily("GPL-2.0", "GPL-3.0"))
+	assert.False(t, repo.SameLicenseFamily("MIT", "apache-2.0"))
+	assert.False(t, repo.SameLicenseFamily("", ""))
+}
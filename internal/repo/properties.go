@@ -2,21 +2,25 @@ package repo
 
 import (
 	"context"
+	"strings"
 
 	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
 )
 
 // GetResolvedProperties fetches custom properties and returns the parsed
-// CustomProperties for each repo. If onlyRepo is set, a single targeted
-// API call is made for that repo instead of paginating the full org list.
-func (c *Content) GetResolvedProperties(onlyRepo string) (map[string]CustomProperties, error) {
-	if onlyRepo != "" {
-		return c.getResolvedPropertiesForRepo(onlyRepo)
+// CustomProperties for each repo matched by the selector. If the selector is a
+// single repo name, a single targeted API call is made for that repo instead of
+// paginating the full org list.
+func (c *Content) GetResolvedProperties(cfg *config.Config, sel *Selector) (map[string]CustomProperties, error) {
+	if repoName, ok := sel.SingleRepo(); ok {
+		return c.getResolvedPropertiesForRepo(cfg, repoName)
 	}
-	return c.getResolvedPropertiesForOrg()
+	return c.getResolvedPropertiesForOrg(cfg, sel)
 }
 
-func (c *Content) getResolvedPropertiesForRepo(repoName string) (map[string]CustomProperties, error) {
+func (c *Content) getResolvedPropertiesForRepo(cfg *config.Config, repoName string) (map[string]CustomProperties, error) {
 	values, _, err := ghDo(func() ([]*github.CustomPropertyValue, *github.Response, error) {
 		return c.githubClient.Repositories.GetAllCustomPropertyValues(context.TODO(), c.githubOrg, repoName)
 	})
@@ -24,46 +28,56 @@ func (c *Content) getResolvedPropertiesForRepo(repoName string) (map[string]Cust
 		return nil, err
 	}
 	return map[string]CustomProperties{
-		repoName: parseCustomProperties(values),
+		repoName: parseCustomProperties(cfg, values),
 	}, nil
 }
 
-func (c *Content) getResolvedPropertiesForOrg() (map[string]CustomProperties, error) {
+func (c *Content) getResolvedPropertiesForOrg(cfg *config.Config, sel *Selector) (map[string]CustomProperties, error) {
 	result := map[string]CustomProperties{}
 
-	opts := &github.ListOptions{
-		Page:    0,
-		PerPage: 100,
+	repos, err := c.listPropertyValues(sel)
+	if err != nil {
+		return nil, err
 	}
-	for {
-		opts.Page++
-		repos, resp, err := ghDo(func() ([]*github.RepoCustomPropertyValue, *github.Response, error) {
-			return c.githubClient.Organizations.ListCustomPropertyValues(context.TODO(), c.githubOrg, opts)
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		for _, repo := range repos {
-			result[repo.RepositoryName] = parseCustomProperties(repo.Properties)
-		}
-
-		if resp.NextPage == 0 {
-			break
-		}
+	for _, repo := range repos {
+		result[repo.RepositoryName] = parseCustomProperties(cfg, repo.Properties)
 	}
 
 	return result, nil
 }
 
 // parseCustomProperties extracts the tool-relevant custom properties from
-// a repo's raw GitHub property list.
-func parseCustomProperties(properties []*github.CustomPropertyValue) CustomProperties {
-	var props CustomProperties
+// a repo's raw GitHub property list, using the property names from the config.
+func parseCustomProperties(cfg *config.Config, properties []*github.CustomPropertyValue) CustomProperties {
+	settings := cfg.GetProperties()
+	props := CustomProperties{
+		Values: map[string]string{},
+	}
 	for _, p := range properties {
-		if p.PropertyName == "repo-content-updater-bypass-pr" && p.Value != nil && *p.Value == "true" {
-			props.BypassPR = true
+		if p.Value == nil {
+			continue
+		}
+		props.Values[p.PropertyName] = *p.Value
+
+		switch p.PropertyName {
+		case settings.BypassPR.Name:
+			props.BypassPR = settings.BypassPR.IsTruthy(*p.Value)
+		case settings.PinVersions.Name:
+			props.PinVersions = parsePinVersions(settings.PinVersions, *p.Value)
 		}
 	}
 	return props
 }
+
+// parsePinVersions parses a list of file@version pins, such as go-test@1,dependabot@2
+func parsePinVersions(property config.Property, value string) map[string]string {
+	pins := map[string]string{}
+	for _, pin := range property.Split(value) {
+		file, version, ok := strings.Cut(pin, "@")
+		if !ok || file == "" || version == "" {
+			continue
+		}
+		pins[file] = version
+	}
+	return pins
+}
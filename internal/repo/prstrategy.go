@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// PlannedPR is a set of files to apply on their own branch and PR. Group or File is set when PRs are
+// split per group or per file.
+type PlannedPR struct {
+	Group string
+	File  string
+	Title string
+	Files []config.FileRef
+}
+
+// prStrategy returns the PR strategy for the repo, preferring the repo config over the org config
+func prStrategy(cfg *config.Config, repoConfig Config) string {
+	if repoConfig.PrStrategy != nil && *repoConfig.PrStrategy != "" {
+		return *repoConfig.PrStrategy
+	}
+	if cfg.PrStrategy != "" {
+		return cfg.PrStrategy
+	}
+	return config.PrStrategySingle
+}
+
+// PlanPRs splits the files into PRs following the strategy. With single, every file is in one PR
+// using the given title. With per-group, files are split by the group they were included through,
+// and with per-file, every file gets its own PR. Split PRs add the group or file name to the title,
+// while files listed directly in per-group keep the given title. PRs are returned in the order
+// their first file appears.
+func PlanPRs(strategy string, files []config.FileRef, title string) []PlannedPR {
+	var prs []PlannedPR
+	index := map[string]int{}
+
+	for _, ref := range files {
+		key := ""
+		switch strategy {
+		case config.PrStrategyPerGroup:
+			key = ref.Group
+		case config.PrStrategyPerFile:
+			key = ref.Name
+		}
+
+		i, ok := index[key]
+		if !ok {
+			pr := PlannedPR{Title: title}
+			if key != "" {
+				pr.Title = fmt.Sprintf("%s (%s)", title, key)
+			}
+			switch strategy {
+			case config.PrStrategyPerGroup:
+				pr.Group = key
+			case config.PrStrategyPerFile:
+				pr.File = key
+			}
+			i = len(prs)
+			index[key] = i
+			prs = append(prs, pr)
+		}
+		prs[i].Files = append(prs[i].Files, ref)
+	}
+
+	return prs
+}
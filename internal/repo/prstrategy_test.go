@@ -0,0 +1,35 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestPlanPRs(t *testing.T) {
+	files := []config.FileRef{
+		{Name: "go-test", Group: "go-ci"},
+		{Name: "dependabot", Group: "base"},
+		{Name: "security"},
+		{Name: "commit-signing", Group: "go-ci"},
+	}
+
+	assert.Equal(t, []repo.PlannedPR{
+		{Title: "Update Managed Files", Files: files},
+	}, repo.PlanPRs(config.PrStrategySingle, files, "Update Managed Files"))
+
+	assert.Equal(t, []repo.PlannedPR{
+		{Group: "go-ci", Title: "Update Managed Files (go-ci)", Files: []config.FileRef{files[0], files[3]}},
+		{Group: "base", Title: "Update Managed Files (base)", Files: []config.FileRef{files[1]}},
+		{Title: "Update Managed Files", Files: []config.FileRef{files[2]}},
+	}, repo.PlanPRs(config.PrStrategyPerGroup, files, "Update Managed Files"))
+
+	prs := repo.PlanPRs(config.PrStrategyPerFile, files, "Update Managed Files")
+	assert.Len(t, prs, 4)
+	assert.Equal(t, repo.PlannedPR{File: "security", Title: "Update Managed Files (security)", Files: []config.FileRef{files[2]}}, prs[2])
+
+	assert.Empty(t, repo.PlanPRs(config.PrStrategySingle, nil, "Update Managed Files"))
+}
@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// RefreshPullRequests regenerates every open PR opened by this tool in the repos matched by the
+// selector. Each PR's branch is recreated from the latest target branch with the current templates
+// and config, and the existing PR is updated. PRs that could not be refreshed are recorded in the report.
+func (c *Content) RefreshPullRequests(cfg *config.Config, sel *Selector) error {
+	return c.forEachRepo(cfg, sel, func(repo *github.RepoCustomPropertyValue) (repoJob, error) {
+		// Every command the repo opts into, since any of them may have opened the PRs
+		var plans []updatePlan
+		managedFiles := managedFilesFor(cfg, repo)
+		if managedFiles != nil {
+			plans = append(plans, c.managedFilesPlan(managedFiles, cfg))
+		}
+		license := c.licenseFor(cfg, repo)
+		if license != nil {
+			plans = append(plans, c.licensePlan(license, cfg))
+		}
+		if files := syncFiles(license, managedFiles); len(files) > 0 {
+			plans = append(plans, c.syncPlan(files, cfg))
+		}
+		if cfg.GetHeaders().TemplateName != "" && manageHeaders(cfg, repo) {
+			plan, err := c.headersPlan(cfg)
+			if err != nil {
+				return nil, err
+			}
+			plans = append(plans, plan)
+		}
+
+		return func(repoName string, props CustomProperties) error {
+			prs, err := c.listManagedPullRequests(cfg, repoName)
+			if err != nil {
+				return fmt.Errorf("error listing pull requests: %w", err)
+			}
+			if len(prs) == 0 {
+				return nil
+			}
+			log.Printf("Refreshing %d PRs in %s\n", len(prs), repoName)
+			return c.refreshRepo(repoName, prs, plans, cfg, props)
+		}, nil
+	})
+}
+
+// refreshRepo runs the branch updates for the branches of the open PRs. PRs whose branch is no longer
+// planned are recorded in the report.
+func (c *Content) refreshRepo(repoName string, prs map[string]*github.PullRequest, plans []updatePlan, cfg *config.Config, props CustomProperties) error {
+	return c.updateRepo(repoName, cfg, props, func(u *repoUpdate) ([]branchUpdate, error) {
+		var updates []branchUpdate
+		for _, plan := range plans {
+			planned, err := plan(u)
+			if err != nil {
+				return nil, err
+			}
+			for _, update := range planned {
+				if prs[update.branch] == nil || slices.ContainsFunc(updates, func(other branchUpdate) bool { return other.branch == update.branch }) {
+					continue
+				}
+				updates = append(updates, update)
+			}
+		}
+
+		for _, branch := range slices.Sorted(maps.Keys(prs)) {
+			if !slices.ContainsFunc(updates, func(update branchUpdate) bool { return update.branch == branch }) {
+				c.report.Add(repoName, branch, StatusFailed, fmt.Sprintf("%s was not refreshed, the config no longer opens a PR from this branch", prs[branch].GetHTMLURL()))
+			}
+		}
+
+		return updates, nil
+	})
+}
+
+// listManagedPullRequests returns the open PRs in the repo opened by this tool, keyed by branch.
+// PRs are recognized like they are when closing redundant PRs, see isManagedPullRequest.
+func (c *Content) listManagedPullRequests(cfg *config.Config, repoName string) (map[string]*github.PullRequest, error) {
+	prs := map[string]*github.PullRequest{}
+	fullName := fmt.Sprintf("%s/%s", c.githubOrg, repoName)
+
+	opts := &github.PullRequestListOptions{
+		State: "open",
+		ListOptions: github.ListOptions{
+			Page:    0,
+			PerPage: 100,
+		},
+	}
+	for {
+		opts.Page++
+		result, resp, err := ghDo(func() ([]*github.PullRequest, *github.Response, error) {
+			return c.githubClient.PullRequests.List(context.TODO(), c.githubOrg, repoName, opts)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pr := range result {
+			// PRs from forks are never the tool's, even with a copied description
+			if !strings.EqualFold(pr.GetHead().GetRepo().GetFullName(), fullName) {
+				continue
+			}
+			managed, err := c.isManagedPullRequest(cfg, repoName, pr)
+			if err != nil {
+				return nil, err
+			}
+			if managed {
+				prs[pr.GetHead().GetRef()] = pr
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	return prs, nil
+}
@@ -1,10 +1,18 @@
 package repo
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
 )
 
 // Config holds configuration data for a repository, including information
@@ -15,19 +23,60 @@ type Config struct {
 	AssignGroup    *string           `yaml:"assign_group"`
 	CommitPrefix   *string           `yaml:"commit_prefix"`
 	VarOverrides   map[string]string `yaml:"var_overrides"`
+	PinVersions    map[string]string `yaml:"pin_versions"`
+
+	// ExcludeFiles lists managed files that should never be applied to this repo
+	ExcludeFiles []string `yaml:"exclude_files"`
+
+	// ProtectedPaths lists paths (or globs) in the repo that should never be written or removed
+	ProtectedPaths []string `yaml:"protected_paths"`
+
+	// FileCustomizations are local additions applied to managed files after rendering, keyed by file name
+	FileCustomizations map[string]FileCustomization `yaml:"file_customizations"`
+
+	// PrStrategy decides how changed files are split into PRs: single, per-group or per-file
+	PrStrategy *string `yaml:"pr_strategy"`
+
+	// HumanCommits decides what happens when the tool's branch has commits from someone else: skip or rebase
+	HumanCommits *string `yaml:"human_commits"`
 }
 
-// LoadRepoConfig loads the repository configuration from the .repo-content-updater.yml file.
-// It returns a RepoConfig struct filled with the loaded configuration and any error encountered during loading.
-func (c *Content) LoadRepoConfig(repopath string) (Config, error) {
-	// Support yml and yaml variants
+// FileCustomization is a local addition to a managed file
+type FileCustomization struct {
+	// Append is content added to the end of the rendered file
+	Append string `yaml:"append"`
+
+	// Patch is the path, relative to the repo root, of a patch to apply to the rendered file
+	Patch string `yaml:"patch"`
+}
+
+// isProtected returns true if the path matches any of the protected paths. Patterns can use ** to
+// match any number of directories, and a directory protects everything under it.
+func (c Config) isProtected(repoPath string) bool {
+	for _, pattern := range c.ProtectedPaths {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if config.MatchAnyGlob([]string{pattern, pattern + "/**"}, repoPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// RepoConfigPath returns the path of the repo config file within the repo, supporting
+// both the .yaml and .yml variants
+func RepoConfigPath(repopath string) string {
 	path := filepath.Join(repopath, ".repo-content-updater.yaml")
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
 		path = filepath.Join(repopath, ".repo-content-updater.yml")
 	}
+	return path
+}
 
-	configBytes, err := os.ReadFile(path)
+// LoadRepoConfig loads the repository configuration from the .repo-content-updater.yml file.
+// It returns a RepoConfig struct filled with the loaded configuration and any error encountered during loading.
+// A missing file results in an empty config, but unknown keys are an error so typos are not silently ignored.
+func LoadRepoConfig(repopath string) (Config, error) {
+	configBytes, err := os.ReadFile(RepoConfigPath(repopath))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return Config{}, nil
@@ -35,12 +84,90 @@ func (c *Content) LoadRepoConfig(repopath string) (Config, error) {
 		return Config{}, err
 	}
 
+	return ParseRepoConfig(configBytes)
+}
+
+// ParseRepoConfig strictly decodes repo config, rejecting any keys that are not supported
+func ParseRepoConfig(configBytes []byte) (Config, error) {
 	var repoconfig Config
-	err = yaml.Unmarshal(configBytes, &repoconfig)
-	if err != nil {
+	decoder := yaml.NewDecoder(bytes.NewReader(configBytes))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&repoconfig)
+	if err != nil && !errors.Is(err, io.EOF) {
 		return Config{}, err
 	}
 
 	return repoconfig, nil
+}
+
+// Validate checks the parts of the repo config that refer to other files in the repo, along with
+// the values that would otherwise fall back to defaults when invalid
+func (c Config) Validate(repopath string) error {
+	var errs []error
+	for name, customization := range c.FileCustomizations {
+		if customization.Patch == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(repopath, customization.Patch)); err != nil {
+			errs = append(errs, fmt.Errorf("file_customizations.%s.patch: %s does not exist", name, customization.Patch))
+		}
+	}
+	errs = append(errs, c.validateValues())
+
+	return errors.Join(errs...)
+}
+
+// validateValues checks the values in the config that do not depend on a clone of the repo, so org
+// and team layers can be checked too
+func (c Config) validateValues() error {
+	var errs []error
+	for _, pattern := range c.ProtectedPaths {
+		if err := config.ValidateGlob(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("protected_paths: invalid pattern %q", pattern))
+		}
+	}
+	if c.PrStrategy != nil {
+		if err := config.ValidatePrStrategy(*c.PrStrategy); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.HumanCommits != nil {
+		if err := config.ValidateHumanCommits(*c.HumanCommits); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// appendContent adds a local addition to the end of rendered content, making sure it starts on a new line
+func appendContent(content []byte, addition string) []byte {
+	if addition == "" {
+		return content
+	}
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	return append(content, addition...)
+}
+
+// applyPatch applies a patch file from the repo to the working tree. The patch may only change the
+// file it customizes, since only that file is committed.
+func applyPatch(dir, patch, repoPath string) error {
+	output, err := exec.Command("git", "-C", dir, "apply", "--numstat", patch).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) == 3 && fields[2] != repoPath {
+			return fmt.Errorf("patch changes %s, it may only change %s", fields[2], repoPath)
+		}
+	}
 
+	output, err = exec.Command("git", "-C", dir, "apply", patch).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
@@ -0,0 +1,147 @@
+package repo_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestExampleRepoConfigIsValid(t *testing.T) {
+	repoConfig, err := repo.LoadRepoConfig("../../examples")
+	assert.Nil(t, err)
+	assert.Equal(t, "develop", *repoConfig.PrTargetBranch)
+}
+
+func TestParseRepoConfigIsStrict(t *testing.T) {
+	_, err := repo.ParseRepoConfig([]byte("pr_target_brnach: develop\n"))
+	assert.ErrorContains(t, err, "field pr_target_brnach not found")
+
+	_, err = repo.ParseRepoConfig([]byte("file_customizations:\n  go-makefile:\n    apend: foo\n"))
+	assert.ErrorContains(t, err, "field apend not found")
+
+	repoConfig, err := repo.ParseRepoConfig([]byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, repo.Config{}, repoConfig)
+}
+
+// TestRepoConfigSchemaMatchesConfig ensures the published JSON schema documents every supported key
+func TestRepoConfigSchemaMatchesConfig(t *testing.T) {
+	schemaBytes, err := os.ReadFile("../../schema/repo-content-updater.schema.json")
+	assert.Nil(t, err)
+
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	assert.Nil(t, json.Unmarshal(schemaBytes, &schema))
+
+	var keys []string
+	configType := reflect.TypeOf(repo.Config{})
+	for i := range configType.NumField() {
+		key, _, _ := strings.Cut(configType.Field(i).Tag.Get("yaml"), ",")
+		keys = append(keys, key)
+	}
+
+	schemaKeys := make([]string, 0, len(schema.Properties))
+	for key := range schema.Properties {
+		schemaKeys = append(schemaKeys, key)
+	}
+	assert.ElementsMatch(t, keys, schemaKeys)
+}
+
+func TestIsProtected(t *testing.T) {
+	repoConfig := repo.Config{ProtectedPaths: []string{".github/workflows/**", "docs/", "custom-*.yml", "SECURITY.md"}}
+
+	assert.True(t, repoConfig.IsProtected(".github/workflows/test.yml"))
+	assert.True(t, repoConfig.IsProtected(".github/workflows/nested/test.yml"))
+	assert.True(t, repoConfig.IsProtected("docs/guide/index.md"))
+	assert.True(t, repoConfig.IsProtected("custom-build.yml"))
+	assert.True(t, repoConfig.IsProtected("SECURITY.md"))
+	assert.False(t, repoConfig.IsProtected(".github/dependabot.yml"))
+	assert.False(t, repoConfig.IsProtected("sub/custom-build.yml"))
+	assert.False(t, repo.Config{}.IsProtected("SECURITY.md"))
+}
+
+func TestAppendContent(t *testing.T) {
+	assert.Equal(t, "rendered\n", string(repo.AppendContent([]byte("rendered\n"), "")))
+	assert.Equal(t, "rendered\nlocal\n", string(repo.AppendContent([]byte("rendered\n"), "local\n")))
+	assert.Equal(t, "rendered\nlocal\n", string(repo.AppendContent([]byte("rendered"), "local\n")))
+	assert.Equal(t, "local\n", string(repo.AppendContent(nil, "local\n")))
+}
+
+func TestSelectFilesSkipsExcludedAndProtected(t *testing.T) {
+	cfg := &config.Config{Files: []config.File{
+		{Name: "dependabot", RepoPath: ".github/dependabot.yml"},
+		{Name: "go-test", RepoPath: ".github/workflows/go-test.yml"},
+		{Name: "security", RepoPath: "SECURITY.md"},
+	}}
+	repoConfig := repo.Config{
+		ExcludeFiles:   []string{"dependabot"},
+		ProtectedPaths: []string{".github/workflows"},
+	}
+
+	selected, report, err := repo.SelectFiles("test-repo", []config.FileRef{{Name: "dependabot"}, {Name: "go-test"}, {Name: "security"}}, cfg, repoConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, []config.FileRef{{Name: "security"}}, selected)
+	assert.Equal(t, []repo.ReportEntry{
+		{Repo: "test-repo", File: "dependabot", Status: repo.StatusSkipped, Reason: "excluded by repo config"},
+		{Repo: "test-repo", File: "go-test", Status: repo.StatusSkipped, Reason: ".github/workflows/go-test.yml is a protected path in repo config"},
+	}, report.Entries())
+}
+
+func TestValidateRepoConfigValues(t *testing.T) {
+	repoConfig, err := repo.ParseRepoConfig([]byte("protected_paths:\n  - \"[docs\"\npr_strategy: per-repo\nhuman_commits: merge\n"))
+	assert.Nil(t, err)
+	err = repoConfig.Validate(t.TempDir())
+	assert.ErrorContains(t, err, `protected_paths: invalid pattern "[docs"`)
+	assert.ErrorContains(t, err, "pr_strategy")
+	assert.ErrorContains(t, err, "human_commits")
+
+	assert.Nil(t, repo.Config{}.Validate(t.TempDir()))
+}
+
+func TestApplyPatchOnlyChangesItsFile(t *testing.T) {
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q", "-b", "main")
+	writeAndCommit(t, dir, "Makefile", "build:\n\tgo build\n", "Initial commit")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("readme\n"), 0644))
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "Makefile"), []byte("build:\n\tgo build ./...\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "makefile.patch"), []byte(gitRun(t, dir, "diff")), 0644))
+	gitRun(t, dir, "add", "README.md")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("changed\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "other.patch"), []byte(gitRun(t, dir, "diff", "HEAD")), 0644))
+	gitRun(t, dir, "reset", "-q", "--hard")
+
+	assert.Nil(t, repo.ApplyPatch(dir, "makefile.patch", "Makefile"))
+	content, err := os.ReadFile(filepath.Join(dir, "Makefile"))
+	assert.Nil(t, err)
+	assert.Equal(t, "build:\n\tgo build ./...\n", string(content))
+	gitRun(t, dir, "checkout", "Makefile")
+
+	// A patch that also changes another file is rejected without changing anything
+	err = repo.ApplyPatch(dir, "other.patch", "Makefile")
+	assert.ErrorContains(t, err, "patch changes README.md, it may only change Makefile")
+	_, err = os.Stat(filepath.Join(dir, "README.md"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHasStagedChanges(t *testing.T) {
+	assert.False(t, repo.HasStagedChanges(git.Status{}))
+	assert.False(t, repo.HasStagedChanges(git.Status{
+		"README.md": {Staging: git.Unmodified, Worktree: git.Modified},
+		"notes.txt": {Staging: git.Untracked, Worktree: git.Untracked},
+	}))
+	assert.True(t, repo.HasStagedChanges(git.Status{
+		"Makefile":  {Staging: git.Modified, Worktree: git.Unmodified},
+		"README.md": {Staging: git.Unmodified, Worktree: git.Modified},
+	}))
+}
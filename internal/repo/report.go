@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	// StatusSkipped indicates a file was not applied to a repo
+	StatusSkipped = "skipped"
+
+	// StatusFailed indicates a repo could not be processed
+	StatusFailed = "failed"
+
+	// StatusBehind indicates a repo is pinned to an older version of a file
+	StatusBehind = "behind"
+
+	// StatusLegalReview indicates a repo has a different license than the managed one, and was
+	// left unchanged so the license can be reviewed
+	StatusLegalReview = "legal-review"
+)
+
+// ReportEntry is a single outcome recorded for a repo during a run
+type ReportEntry struct {
+	Repo   string
+	File   string
+	Status string
+	Reason string
+}
+
+// Report collects per-repo outcomes during a run so they can be summarized at the end
+type Report struct {
+	entries []ReportEntry
+}
+
+// Add records an outcome for the given repo and file
+func (r *Report) Add(repo, file, status, reason string) {
+	r.entries = append(r.entries, ReportEntry{
+		Repo:   repo,
+		File:   file,
+		Status: status,
+		Reason: reason,
+	})
+}
+
+// Entries returns the recorded outcomes sorted by repo
+func (r *Report) Entries() []ReportEntry {
+	entries := make([]ReportEntry, len(r.entries))
+	copy(entries, r.entries)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Repo < entries[j].Repo
+	})
+	return entries
+}
+
+// Print writes a summary of the report to w. Nothing is written if the report is empty.
+func (r *Report) Print(w io.Writer) {
+	if len(r.entries) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, "Report:")
+	for _, entry := range r.Entries() {
+		subject := entry.Repo
+		if entry.File != "" {
+			subject = fmt.Sprintf("%s %s", entry.Repo, entry.File)
+		}
+		_, _ = fmt.Fprintf(w, "  %s: %s (%s)\n", subject, entry.Status, entry.Reason)
+	}
+}
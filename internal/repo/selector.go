@@ -0,0 +1,411 @@
+package repo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// Selector decides which repos in the org a command applies to. Every set criteria must match
+// for a repo to be selected, and a repo matching any exclusion is never selected.
+type Selector struct {
+	// Repos are repo names or glob patterns, such as chia-*. Empty matches every repo.
+	Repos []string
+
+	// Exclude are repo names or glob patterns that are never selected
+	Exclude []string
+
+	// Topics selects repos with at least one of the topics
+	Topics []string
+
+	// TeamOwnedBy selects repos where at least one of the team slugs has admin or maintain access
+	TeamOwnedBy []string
+
+	// Visibility limits processing to repos with one of these visibilities. Empty allows every visibility.
+	Visibility []string
+
+	// ForceInclude are repo names or glob patterns that are processed even if they are archived,
+	// disabled, forks, empty or have a visibility that is not allowed
+	ForceInclude []string
+}
+
+// visibilities are the repo visibilities GitHub reports
+var visibilities = []string{"public", "private", "internal"}
+
+// NewSelector validates the selector criteria and returns the selector. If reposFile is set, repo
+// names or patterns are also read from it, one per line, ignoring blank lines and lines starting with #.
+func NewSelector(criteria Selector, reposFile string) (*Selector, error) {
+	s := &criteria
+
+	if reposFile != "" {
+		file, err := os.Open(reposFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading repos file: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			s.Repos = append(s.Repos, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading repos file: %w", err)
+		}
+	}
+
+	for _, pattern := range slices.Concat(s.Repos, s.Exclude, s.ForceInclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid repo pattern %q: %w", pattern, err)
+		}
+	}
+	for _, visibility := range s.Visibility {
+		if !slices.Contains(visibilities, visibility) {
+			return nil, fmt.Errorf("invalid visibility %q, must be one of %s", visibility, strings.Join(visibilities, ", "))
+		}
+	}
+
+	return s, nil
+}
+
+// IsEmpty returns true if the selector has no criteria, and so selects every repo
+func (s *Selector) IsEmpty() bool {
+	return s == nil || (len(s.Repos) == 0 && len(s.Exclude) == 0 && len(s.Topics) == 0 && len(s.TeamOwnedBy) == 0)
+}
+
+// SingleRepo returns the repo name if the selector is exactly one repo name with no other
+// criteria, so callers can skip listing the whole org
+func (s *Selector) SingleRepo() (string, bool) {
+	if s == nil || len(s.Repos) != 1 || len(s.Exclude) > 0 || len(s.Topics) > 0 || len(s.TeamOwnedBy) > 0 {
+		return "", false
+	}
+	if strings.ContainsAny(s.Repos[0], `*?[\`) {
+		return "", false
+	}
+	return s.Repos[0], true
+}
+
+// MatchesName returns true if the repo name matches the repo patterns and no exclusions.
+// Names are compared case-insensitively.
+func (s *Selector) MatchesName(name string) bool {
+	if s == nil {
+		return true
+	}
+	if len(s.Repos) > 0 && !matchAny(s.Repos, name) {
+		return false
+	}
+	return !matchAny(s.Exclude, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// UnsuitableReason returns why the repo should not be processed even though it was selected, or an
+// empty string if it should be. Repos matching ForceInclude are always suitable.
+func (s *Selector) UnsuitableReason(repo *github.Repository) string {
+	if s != nil && matchAny(s.ForceInclude, repo.GetName()) {
+		return ""
+	}
+
+	switch {
+	case repo.GetArchived():
+		return "repo is archived"
+	case repo.GetDisabled():
+		return "repo is disabled"
+	case repo.GetFork():
+		return "repo is a fork"
+	case repo.GetSize() == 0:
+		return "repo is empty"
+	case s != nil && len(s.Visibility) > 0 && !slices.Contains(s.Visibility, repo.GetVisibility()):
+		return fmt.Sprintf("repo visibility %s is not allowed", repo.GetVisibility())
+	}
+
+	return ""
+}
+
+// suitableRepo checks the repo metadata to decide whether a selected repo can be processed. Unsuitable
+// repos are recorded as skipped in the report.
+func (c *Content) suitableRepo(sel *Selector, repoName string) (bool, error) {
+	repo, err := c.repoMetadata(sel, repoName)
+	if err != nil {
+		return false, err
+	}
+	if repo == nil {
+		c.report.Add(repoName, "", StatusSkipped, "repo not found in org")
+		return false, nil
+	}
+
+	if reason := sel.UnsuitableReason(repo); reason != "" {
+		log.Printf("Skipping %s: %s\n", repoName, reason)
+		c.report.Add(repoName, "", StatusSkipped, reason)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// repoMetadata returns the metadata for a repo. When only a single repo is selected it is fetched
+// directly rather than listing the whole org.
+func (c *Content) repoMetadata(sel *Selector, repoName string) (*github.Repository, error) {
+	if _, ok := sel.SingleRepo(); ok && c.orgRepos == nil {
+		repo, _, err := ghDo(func() (*github.Repository, *github.Response, error) {
+			return c.githubClient.Repositories.Get(context.TODO(), c.githubOrg, repoName)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting repo: %w", err)
+		}
+		return repo, nil
+	}
+
+	return c.orgRepo(repoName)
+}
+
+// selectRepo returns true if the repo matches every criteria of the selector. Repo metadata and
+// team ownership are only fetched when the selector filters on them.
+func (c *Content) selectRepo(sel *Selector, repoName string) (bool, error) {
+	if !sel.MatchesName(repoName) {
+		return false, nil
+	}
+
+	if len(sel.Topics) > 0 {
+		repo, err := c.orgRepo(repoName)
+		if err != nil {
+			return false, err
+		}
+		if repo == nil || !slices.ContainsFunc(repo.Topics, func(topic string) bool {
+			return slices.Contains(sel.Topics, topic)
+		}) {
+			return false, nil
+		}
+	}
+
+	if len(sel.TeamOwnedBy) > 0 {
+		owned := false
+		for _, team := range sel.TeamOwnedBy {
+			repos, err := c.teamOwnedRepos(team)
+			if err != nil {
+				return false, err
+			}
+			if repos[strings.ToLower(repoName)] {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// SelectRepos returns the names of every repo in the org matched by the selector that is suitable
+// to process
+func (c *Content) SelectRepos(sel *Selector) ([]string, error) {
+	if name, ok := sel.SingleRepo(); ok {
+		suitable, err := c.suitableRepo(sel, name)
+		if err != nil || !suitable {
+			return nil, err
+		}
+		return []string{name}, nil
+	}
+
+	repos, err := c.listOrgRepos()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, repo := range repos {
+		ok, err := c.selectRepo(sel, repo.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		ok, err = c.suitableRepo(sel, repo.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			selected = append(selected, repo.GetName())
+		}
+	}
+
+	slices.Sort(selected)
+	return selected, nil
+}
+
+// listPropertyValues returns the custom property values for every repo in the org matched by the selector
+func (c *Content) listPropertyValues(sel *Selector) ([]*github.RepoCustomPropertyValue, error) {
+	var selected []*github.RepoCustomPropertyValue
+
+	opts := &github.ListOptions{
+		Page:    0,
+		PerPage: 100,
+	}
+	for {
+		opts.Page++
+		result, resp, err := ghDo(func() ([]*github.RepoCustomPropertyValue, *github.Response, error) {
+			return c.githubClient.Organizations.ListCustomPropertyValues(context.TODO(), c.githubOrg, opts)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range result {
+			ok, err := c.selectRepo(sel, repo.RepositoryName)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				selected = append(selected, repo)
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	return selected, nil
+}
+
+// repoJob processes a single repo, with the repo's custom properties
+type repoJob func(repoName string, props CustomProperties) error
+
+// forEachRepo runs a job for every repo matched by the selector. jobFor returns the repo's job, or nil
+// if the command does not apply to the repo. Repos that are not suitable are skipped, and repos whose
+// job fails are recorded as failed in the report without stopping the others.
+func (c *Content) forEachRepo(cfg *config.Config, sel *Selector, jobFor func(repo *github.RepoCustomPropertyValue) (repoJob, error)) error {
+	repos, err := c.listPropertyValues(sel)
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range repos {
+		job, err := jobFor(repo)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			continue
+		}
+		suitable, err := c.suitableRepo(sel, repo.RepositoryName)
+		if err != nil {
+			return err
+		}
+		if !suitable {
+			continue
+		}
+		log.Printf("Need to check %s\n", repo.RepositoryName)
+		err = job(repo.RepositoryName, parseCustomProperties(cfg, repo.Properties))
+		if err != nil {
+			log.Printf("Error updating %s: %s\n", repo.RepositoryName, err.Error())
+			c.report.Add(repo.RepositoryName, "", StatusFailed, err.Error())
+			continue
+		}
+	}
+
+	return nil
+}
+
+// listOrgRepos returns metadata for every repo in the org. The list is cached for the run.
+func (c *Content) listOrgRepos() (map[string]*github.Repository, error) {
+	if c.orgRepos != nil {
+		return c.orgRepos, nil
+	}
+
+	repos := map[string]*github.Repository{}
+	opts := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{
+			Page:    0,
+			PerPage: 100,
+		},
+	}
+	for {
+		opts.Page++
+		result, resp, err := ghDo(func() ([]*github.Repository, *github.Response, error) {
+			return c.githubClient.Repositories.ListByOrg(context.TODO(), c.githubOrg, opts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing repos: %w", err)
+		}
+
+		for _, repo := range result {
+			repos[strings.ToLower(repo.GetName())] = repo
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	c.orgRepos = repos
+	return repos, nil
+}
+
+// orgRepo returns the metadata for a single repo, or nil if it is not in the org
+func (c *Content) orgRepo(repoName string) (*github.Repository, error) {
+	repos, err := c.listOrgRepos()
+	if err != nil {
+		return nil, err
+	}
+	return repos[strings.ToLower(repoName)], nil
+}
+
+// teamOwnedRepos returns the lowercased names of repos where the team has admin or maintain
+// access. Results are cached for the run.
+func (c *Content) teamOwnedRepos(team string) (map[string]bool, error) {
+	if repos, ok := c.teamRepos[team]; ok {
+		return repos, nil
+	}
+
+	repos := map[string]bool{}
+	opts := &github.ListOptions{
+		Page:    0,
+		PerPage: 100,
+	}
+	for {
+		opts.Page++
+		result, resp, err := ghDo(func() ([]*github.Repository, *github.Response, error) {
+			return c.githubClient.Teams.ListTeamReposBySlug(context.TODO(), c.githubOrg, team, opts)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing repos for team %s: %w", team, err)
+		}
+
+		for _, repo := range result {
+			permissions := repo.GetPermissions()
+			if permissions["admin"] || permissions["maintain"] {
+				repos[strings.ToLower(repo.GetName())] = true
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+	}
+
+	c.teamRepos[team] = repos
+	return repos, nil
+}
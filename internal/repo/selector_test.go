@@ -0,0 +1,84 @@
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v59/github"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestSelectorMatchesName(t *testing.T) {
+	sel, err := repo.NewSelector(repo.Selector{Repos: []string{"chia-*", "CAT-admin-tool"}, Exclude: []string{"chia-blockchain"}}, "")
+	assert.Nil(t, err)
+
+	assert.True(t, sel.MatchesName("chia-wallet"))
+	assert.True(t, sel.MatchesName("Chia-Wallet"))
+	assert.True(t, sel.MatchesName("cat-admin-tool"))
+	assert.False(t, sel.MatchesName("chia-blockchain"))
+	assert.False(t, sel.MatchesName("go-modules"))
+
+	empty, err := repo.NewSelector(repo.Selector{Exclude: []string{"go-*"}}, "")
+	assert.Nil(t, err)
+	assert.True(t, empty.MatchesName("chia-blockchain"))
+	assert.False(t, empty.MatchesName("go-modules"))
+
+	_, err = repo.NewSelector(repo.Selector{Repos: []string{"chia-["}}, "")
+	assert.NotNil(t, err)
+
+	_, err = repo.NewSelector(repo.Selector{Visibility: []string{"secret"}}, "")
+	assert.NotNil(t, err)
+}
+
+func TestSelectorReposFile(t *testing.T) {
+	reposFile := filepath.Join(t.TempDir(), "repos.txt")
+	assert.Nil(t, os.WriteFile(reposFile, []byte("# wallet repos\nchia-wallet\n\n  cat-*  \n"), 0644))
+
+	sel, err := repo.NewSelector(repo.Selector{Repos: []string{"go-modules"}}, reposFile)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"go-modules", "chia-wallet", "cat-*"}, sel.Repos)
+	assert.True(t, sel.MatchesName("cat-admin-tool"))
+}
+
+func TestSelectorSingleRepo(t *testing.T) {
+	sel, err := repo.NewSelector(repo.Selector{Repos: []string{"chia-blockchain"}}, "")
+	assert.Nil(t, err)
+	name, ok := sel.SingleRepo()
+	assert.True(t, ok)
+	assert.Equal(t, "chia-blockchain", name)
+
+	for _, sel := range []*repo.Selector{
+		{Repos: []string{"chia-*"}},
+		{Repos: []string{"chia-blockchain", "chia-wallet"}},
+		{Repos: []string{"chia-blockchain"}, Topics: []string{"wallet"}},
+		{},
+	} {
+		_, ok := sel.SingleRepo()
+		assert.False(t, ok)
+	}
+}
+
+func TestSelectorUnsuitableReason(t *testing.T) {
+	sel, err := repo.NewSelector(repo.Selector{Visibility: []string{"public"}, ForceInclude: []string{"legacy-*"}}, "")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		repo     *github.Repository
+		expected string
+	}{
+		{&github.Repository{Name: github.String("chia-blockchain"), Size: github.Int(100), Visibility: github.String("public")}, ""},
+		{&github.Repository{Name: github.String("old"), Archived: github.Bool(true), Size: github.Int(100)}, "repo is archived"},
+		{&github.Repository{Name: github.String("blocked"), Disabled: github.Bool(true), Size: github.Int(100)}, "repo is disabled"},
+		{&github.Repository{Name: github.String("forked"), Fork: github.Bool(true), Size: github.Int(100)}, "repo is a fork"},
+		{&github.Repository{Name: github.String("new"), Size: github.Int(0), Visibility: github.String("public")}, "repo is empty"},
+		{&github.Repository{Name: github.String("secret"), Size: github.Int(100), Visibility: github.String("private")}, "repo visibility private is not allowed"},
+		{&github.Repository{Name: github.String("legacy-wallet"), Archived: github.Bool(true), Size: github.Int(100)}, ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, sel.UnsuitableReason(test.repo), test.repo.GetName())
+	}
+}
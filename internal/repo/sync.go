@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// SyncRepos applies the license and managed files of the repos matched by the selector in one pass,
+// with a single clone and at most one PR per repo
+func (c *Content) SyncRepos(cfg *config.Config, sel *Selector) error {
+	return c.forEachRepo(cfg, sel, func(repo *github.RepoCustomPropertyValue) (repoJob, error) {
+		files := syncFiles(c.licenseFor(cfg, repo), managedFilesFor(cfg, repo))
+		if len(files) == 0 {
+			return nil, nil
+		}
+		return func(repoName string, props CustomProperties) error {
+			return c.SyncRepo(repoName, files, cfg, props)
+		}, nil
+	})
+}
+
+// syncFiles returns the license, if any, along with the managed files
+func syncFiles(license *config.File, managedFiles []config.FileRef) []config.FileRef {
+	var files []config.FileRef
+	if license != nil {
+		files = append(files, config.FileRef{Name: license.Name})
+	}
+	files = append(files, managedFiles...)
+	return config.DedupeFileRefs(files)
+}
+
+// SyncRepo applies the given files, including the license file, to the repo in a single PR
+func (c *Content) SyncRepo(repoName string, files []config.FileRef, cfg *config.Config, props CustomProperties) error {
+	return c.updateRepo(repoName, cfg, props, c.syncPlan(files, cfg))
+}
+
+// syncPlan returns the plan for the sync command, which always opens a single PR whatever the
+// repo's pr_strategy
+func (c *Content) syncPlan(files []config.FileRef, cfg *config.Config) updatePlan {
+	return c.planFiles(files, cfg, config.BranchKindSync, "Update Managed Content", false)
+}
@@ -4,20 +4,67 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
-	"strconv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"text/template"
-	"time"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
 )
 
-// ProcessTemplate renders the given template file
-func ProcessTemplate(templateContent []byte, defaultVars map[string]string, overrides map[string]string) ([]byte, error) {
-	// Compute the SHA256 hash of the template content
-	hash := sha256.Sum256(templateContent)
-	hexHash := hex.EncodeToString(hash[:])
+// LoadPartials reads every file in the given directory and returns the contents
+// keyed by partial name. The partial name is the file name without its extension,
+// so partials/checkout-steps.tmpl can be used as {{ template "checkout-steps" . }}.
+// Dotfiles are ignored, and two files with the same name but different extensions are
+// an error. A missing directory is not an error and results in no partials.
+func LoadPartials(dir string) (map[string]string, error) {
+	partials := map[string]string{}
+	if dir == "" {
+		return partials, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return partials, nil
+		}
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, entry := range entries {
+		// Dotfiles, such as .gitkeep, are not partials
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if other, ok := files[name]; ok {
+			return nil, fmt.Errorf("partials %s and %s are both named %s", other, entry.Name(), name)
+		}
+		files[name] = entry.Name()
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		partials[name] = string(content)
+	}
+
+	return partials, nil
+}
 
+// ProcessTemplate renders the given template file
+// Partials are parsed before the template itself, so any {{ define }} in the template
+// overrides a {{ block }} of the same name from a partial.
+func ProcessTemplate(templateContent []byte, partials map[string]string, defaultVars map[string]string, overrides map[string]string) ([]byte, error) {
 	notOverridable := map[string]bool{"CURRENT_YEAR": true}
 	data := map[string]string{
-		"CURRENT_YEAR": strconv.Itoa(time.Now().Year()),
+		"CURRENT_YEAR": currentYear(),
+		// COPYRIGHT_YEARS is overridden with the years since the repo's first commit when rendering for a repo
+		"COPYRIGHT_YEARS": currentYear(),
 	}
 
 	// Merge `defaultVars` into `data`
@@ -36,15 +83,89 @@ func ProcessTemplate(templateContent []byte, defaultVars map[string]string, over
 		data[key] = value
 	}
 
-	tmpl, err := template.New(hexHash).Parse(string(templateContent))
+	tmpl, err := parseTemplate(templateContent, partials)
 	if err != nil {
 		return nil, err
 	}
 
 	var processedTemplate bytes.Buffer
-	if err = tmpl.Execute(&processedTemplate, data); err != nil {
+	if err := tmpl.Execute(&processedTemplate, data); err != nil {
 		return nil, err
 	}
 
 	return processedTemplate.Bytes(), nil
 }
+
+// parseTemplate parses the template content along with all partials
+func parseTemplate(templateContent []byte, partials map[string]string) (*template.Template, error) {
+	// Compute the SHA256 hash of the template content
+	hash := sha256.Sum256(templateContent)
+	hexHash := hex.EncodeToString(hash[:])
+
+	tmpl := template.New(hexHash)
+
+	// Sort partial names so redefinitions across partials resolve the same way every run
+	names := make([]string, 0, len(partials))
+	for name := range partials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := tmpl.New(name).Parse(partials[name]); err != nil {
+			return nil, fmt.Errorf("error parsing partial %s: %w", name, err)
+		}
+	}
+
+	return tmpl.Parse(string(templateContent))
+}
+
+// ValidateTemplates ensures every file in the config references templates (including pinnable
+// older versions) that exist in the templates directory, and that every template in the directory
+// parses and renders with the default variables. All problems found are returned together as a
+// single error.
+func ValidateTemplates(cfg *config.Config, templatesDir string, partials map[string]string) error {
+	var errs []error
+
+	for _, file := range cfg.Files {
+		templateNames := []string{file.TemplateName}
+		for _, templateName := range file.Versions {
+			templateNames = append(templateNames, templateName)
+		}
+		sort.Strings(templateNames[1:])
+
+		for _, templateName := range templateNames {
+			if templateName == "" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(templatesDir, templateName)); err != nil {
+				errs = append(errs, fmt.Errorf("file %q: template %s not found in %s", file.Name, templateName, templatesDir))
+			}
+		}
+	}
+
+	if templateName := cfg.Headers.TemplateName; templateName != "" {
+		if _, err := os.Stat(filepath.Join(templatesDir, templateName)); err != nil {
+			errs = append(errs, fmt.Errorf("headers: template %s not found in %s", templateName, templatesDir))
+		}
+	}
+
+	entries, err := os.ReadDir(templatesDir)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(templatesDir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := ProcessTemplate(content, partials, cfg.Variables, nil); err != nil {
+			errs = append(errs, fmt.Errorf("template %s: %w", entry.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -2,31 +2,104 @@ package repo_test
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/chia-network/repo-content-updater/internal/config"
 	"github.com/chia-network/repo-content-updater/internal/repo"
 )
 
 func TestProcessTemplateOverrides(t *testing.T) {
 	template := []byte(`{{ .CURRENT_YEAR }} {{ .CGO_ENABLED }}`)
 
-	result, err := repo.ProcessTemplate(template, map[string]string{"CGO_ENABLED": "0"}, map[string]string{})
+	result, err := repo.ProcessTemplate(template, nil, map[string]string{"CGO_ENABLED": "0"}, map[string]string{})
 	assert.Nil(t, err)
 	assert.Equal(t, string([]byte(fmt.Sprintf("%d 0", time.Now().Year()))), string(result))
 
 	// Ensure allowed overrides work
-	result, err = repo.ProcessTemplate(template, map[string]string{}, map[string]string{"CGO_ENABLED": "1"})
+	result, err = repo.ProcessTemplate(template, nil, map[string]string{}, map[string]string{"CGO_ENABLED": "1"})
 	assert.Nil(t, err)
 	assert.Equal(t, []byte(fmt.Sprintf("%d 1", time.Now().Year())), result)
 
 	// Ensure disallowed overrides dont override
-	result, err = repo.ProcessTemplate(template, map[string]string{}, map[string]string{
+	result, err = repo.ProcessTemplate(template, nil, map[string]string{}, map[string]string{
 		"CGO_ENABLED":  "1",
 		"CURRENT_YEAR": "1990",
 	})
 	assert.Nil(t, err)
 	assert.Equal(t, []byte(fmt.Sprintf("%d 1", time.Now().Year())), result)
 }
+
+func TestProcessTemplatePartials(t *testing.T) {
+	partials := map[string]string{
+		"checkout-steps": `- uses: actions/checkout@v7`,
+		"layout":         `{{ block "name" . }}default{{ end }}: {{ template "checkout-steps" . }}`,
+	}
+
+	// Partials are usable from the template
+	result, err := repo.ProcessTemplate([]byte(`{{ template "layout" . }}`), partials, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "default: - uses: actions/checkout@v7", string(result))
+
+	// Templates can override blocks defined in partials
+	result, err = repo.ProcessTemplate([]byte(`{{ define "name" }}{{ .NAME }}{{ end }}{{ template "layout" . }}`), partials, map[string]string{"NAME": "test"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "test: - uses: actions/checkout@v7", string(result))
+}
+
+func TestLoadPartials(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "checkout-steps.tmpl"), []byte("steps"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".gitkeep"), nil, 0644))
+
+	partials, err := repo.LoadPartials(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"checkout-steps": "steps"}, partials)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "checkout-steps.yml"), []byte("other"), 0644))
+	_, err = repo.LoadPartials(dir)
+	assert.ErrorContains(t, err, "partials checkout-steps.tmpl and checkout-steps.yml are both named checkout-steps")
+}
+
+func TestTemplatesAreValid(t *testing.T) {
+	cfg, err := config.LoadConfig("../../config.yaml")
+	assert.Nil(t, err)
+
+	partials, err := repo.LoadPartials("../../partials")
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.ValidateTemplates(cfg, "../../templates", partials))
+}
+
+func TestProcessTemplateYears(t *testing.T) {
+	repo.SetClock(t, time.Date(2030, time.January, 2, 0, 0, 0, 0, time.UTC))
+
+	template := []byte(`{{ .CURRENT_YEAR }} {{ .COPYRIGHT_YEARS }}`)
+
+	result, err := repo.ProcessTemplate(template, nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "2030 2030", string(result))
+
+	result, err = repo.ProcessTemplate(template, nil, nil, map[string]string{"COPYRIGHT_YEARS": "2021-2030"})
+	assert.Nil(t, err)
+	assert.Equal(t, "2030 2021-2030", string(result))
+}
+
+func TestOnlyYearsChanged(t *testing.T) {
+	assert.True(t, repo.OnlyYearsChanged([]byte("Copyright 2024 Chia"), []byte("Copyright 2030 Chia")))
+	assert.True(t, repo.OnlyYearsChanged([]byte("Copyright 2021-2024 Chia"), []byte("Copyright 2021-2030 Chia")))
+	assert.True(t, repo.OnlyYearsChanged([]byte("Copyright 2024 Chia"), []byte("Copyright 2021-2030 Chia")))
+	assert.False(t, repo.OnlyYearsChanged([]byte("Copyright 2024 Chia"), []byte("Copyright 2024 Chia")))
+	assert.False(t, repo.OnlyYearsChanged([]byte("Copyright 2024 Chia"), []byte("Copyright 2030 Chia Network")))
+	assert.True(t, repo.OnlyYearsChanged([]byte("MIT License\n\nCopyright (c) 2024 Chia\n"), []byte("MIT License\n\nCopyright (c) 2030 Chia\n")))
+
+	// Numbers that look like years are only ignored on copyright lines
+	assert.False(t, repo.OnlyYearsChanged([]byte("pattern: 2026\\.3\\.28-2\n"), []byte("pattern: 2027\\.3\\.28-2\n")))
+	assert.False(t, repo.OnlyYearsChanged([]byte("ranges: \\x{2066}-\\x{2069}\n"), []byte("ranges: \\x{2067}-\\x{2069}\n")))
+	assert.False(t, repo.OnlyYearsChanged([]byte("version: 2024\n"), []byte("version: 2025\n")))
+	assert.False(t, repo.OnlyYearsChanged([]byte("Copyright 2024 Chia\n"), []byte("Copyright 2024 Chia\nextra\n")))
+}
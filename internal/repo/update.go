@@ -0,0 +1,244 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// repoUpdate is a clone of a repo checked out on a new branch from the PR target branch, along with
+// the resolved repo config, ready for changes to be committed
+type repoUpdate struct {
+	name     string
+	dir      string
+	repo     *git.Repository
+	worktree *git.Worktree
+	config   Config
+	props    CustomProperties
+	facts    RepoFacts
+
+	// copyrightYears caches the years since the repo's first commit
+	copyrightYears string
+}
+
+// branchUpdate is a set of changes made on its own branch and opened as its own PR
+type branchUpdate struct {
+	branch string
+	title  string
+
+	// update makes the changes as commits, and returns true if anything was committed
+	update func(u *repoUpdate) (bool, error)
+}
+
+// updatePlan returns the branch updates to make in a repo
+type updatePlan func(u *repoUpdate) ([]branchUpdate, error)
+
+// updateRepo clones the repo once, resolves its config and checks out the PR target branch. plan
+// then returns the branch updates to make, and each one is applied on its own branch created from the
+// PR target branch. Every branch with commits is pushed with a PR. A failing branch does not stop
+// the others, and all errors are returned together. An open PR from a branch with no changes left is closed.
+func (c *Content) updateRepo(repoName string, cfg *config.Config, props CustomProperties, plan updatePlan) error {
+	defer c.removeClone(repoName)
+
+	r, w, err := c.cloneRepo(repoName)
+	if err != nil {
+		return err
+	}
+
+	repoConfig, err := LoadRepoConfig(c.repoDir(repoName))
+	if err != nil {
+		return fmt.Errorf("invalid repo config, skipping %s: %w", repoName, err)
+	}
+
+	resolvedConfig, err := c.ResolveRepoConfig(repoName, repoConfig, cfg, props)
+	if err != nil {
+		return fmt.Errorf("error resolving config for %s: %w", repoName, err)
+	}
+	repoConfig = resolvedConfig.Config
+
+	// Invalid values would otherwise fall back to defaults, such as an invalid protected_paths
+	// pattern protecting nothing
+	err = repoConfig.Validate(c.repoDir(repoName))
+	if err != nil {
+		return fmt.Errorf("invalid repo config, skipping %s: %w", repoName, err)
+	}
+
+	headRef, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("error getting head ref for %s: %w", repoName, err)
+	}
+	headRefName := headRef.Name()
+	if !headRefName.IsBranch() {
+		return errors.New("HEAD ref is not a branch")
+	}
+	defaultBranch := headRefName.Short()
+
+	// If we are targeting a different branch with PRs, then our base also needs to start from that branch
+	if repoConfig.PrTargetBranch != nil && *repoConfig.PrTargetBranch != defaultBranch {
+		err = c.checkoutBranch(r, w, *repoConfig.PrTargetBranch)
+		if err != nil {
+			return fmt.Errorf("error checking out branch %s: %w", *repoConfig.PrTargetBranch, err)
+		}
+	}
+
+	repo, _, err := ghDo(func() (*github.Repository, *github.Response, error) {
+		return c.githubClient.Repositories.Get(context.TODO(), c.githubOrg, repoName)
+	})
+	if err != nil {
+		return fmt.Errorf("error getting repo info: %w", err)
+	}
+
+	base, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("error getting head ref for %s: %w", repoName, err)
+	}
+
+	var DefaultBranch string
+	if repoConfig.PrTargetBranch == nil || *repoConfig.PrTargetBranch == "" {
+		DefaultBranch = *repo.DefaultBranch
+	} else {
+		DefaultBranch = *repoConfig.PrTargetBranch
+	}
+
+	u := &repoUpdate{
+		name:     repoName,
+		dir:      c.repoDir(repoName),
+		repo:     r,
+		worktree: w,
+		config:   repoConfig,
+		props:    props,
+		facts: RepoFacts{
+			Name:       repoName,
+			Language:   repo.GetLanguage(),
+			Visibility: repo.GetVisibility(),
+			Archived:   repo.GetArchived(),
+			Properties: props.Values,
+			dir:        c.repoDir(repoName),
+		},
+	}
+
+	updates, err := plan(u)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, update := range updates {
+		start, err := c.prepareBranch(u, cfg, update.branch, DefaultBranch)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", update.branch, err))
+			continue
+		}
+		if start == nil {
+			continue
+		}
+
+		// Every branch starts from the PR target branch, discarding anything left by the previous branch
+		err = w.Checkout(&git.CheckoutOptions{Hash: base.Hash(), Force: true})
+		if err != nil {
+			return fmt.Errorf("error resetting to %s: %w", DefaultBranch, err)
+		}
+
+		err = c.createBranch(r, w, update.branch)
+		if err != nil {
+			return err
+		}
+
+		hadChanges, err := update.update(u)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", update.branch, err))
+			continue
+		}
+
+		if !hadChanges {
+			// A PR left open from an earlier run is no longer needed. Branches with commits from
+			// someone else are left alone.
+			if start.force {
+				err = c.closeRedundantPullRequest(cfg, repoName, update.branch)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", update.branch, err))
+				}
+			}
+			continue
+		}
+
+		if len(start.replay) > 0 {
+			// Commits from someone else are applied on top of the changes. If they touch the same
+			// lines, the branch is left alone like it is for human_commits: skip.
+			err = c.replayCommits(u, start.replay)
+			if errors.Is(err, errReplayConflict) {
+				log.Printf("Commits on %s conflict with the changes: %s\n", update.branch, err.Error())
+				err = c.skipHumanCommits(u, update.branch, "it was not updated, since those commits conflict with the updated content")
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", update.branch, err))
+				}
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", update.branch, err))
+				continue
+			}
+		}
+
+		err = c.pushAndPR(r, repoName, update.branch, update.title, &pushAndPROptions{
+			PrTargetBranch: &DefaultBranch,
+			AssignUsers:    repoConfig.AssignUsers,
+			AssignGroup:    repoConfig.AssignGroup,
+			BypassPR:       props.BypassPR,
+			Force:          start.force,
+			Lease:          start.lease,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", update.branch, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// singleBranch returns a plan with a single branch update
+func singleBranch(branchName, title string, update func(u *repoUpdate) (bool, error)) updatePlan {
+	return func(u *repoUpdate) ([]branchUpdate, error) {
+		return []branchUpdate{{branch: branchName, title: title, update: update}}, nil
+	}
+}
+
+// commitChanges commits the staged changes, adding the commit prefix from the repo config to the
+// message. Nothing is committed and false is returned if nothing is staged.
+func (c *Content) commitChanges(u *repoUpdate, message string) (bool, error) {
+	status, err := u.worktree.Status()
+	if err != nil {
+		return false, err
+	}
+
+	// Only staged changes are committed, anything else left in the worktree is not part of this commit
+	if !hasStagedChanges(status) {
+		return false, nil
+	}
+
+	if u.config.CommitPrefix != nil {
+		message = fmt.Sprintf("%s %s", *u.config.CommitPrefix, message)
+	}
+	err = c.commit(u.worktree, u.name, message)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// hasStagedChanges returns true if any file in the status has changes staged for commit
+func hasStagedChanges(status git.Status) bool {
+	for _, file := range status {
+		if file.Staging != git.Unmodified && file.Staging != git.Untracked {
+			return true
+		}
+	}
+	return false
+}
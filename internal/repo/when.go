@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"text/template"
+)
+
+// RepoFacts are the attributes of a repo that `when` conditions are evaluated against
+type RepoFacts struct {
+	Name       string
+	Language   string
+	Visibility string
+	Archived   bool
+	Properties map[string]string
+
+	// dir is the path to the local clone, used to check for the existence of paths
+	dir string
+}
+
+// Evaluate evaluates a `when` condition against the repo facts.
+// The condition is a text/template pipeline, such as `eq .Language "Go"` or
+// `and (exists "go.mod") (not .Archived)`. An empty condition always matches.
+//
+// In addition to the standard template functions, the following are available:
+//   - exists "path": true if the path (or glob) exists in the repo clone
+//   - property "name": the value of the custom property, or an empty string if unset
+func (f RepoFacts) Evaluate(condition string) (bool, error) {
+	if condition == "" {
+		return true, nil
+	}
+
+	funcs := template.FuncMap{
+		"exists": func(pattern string) (bool, error) {
+			matches, err := filepath.Glob(filepath.Join(f.dir, pattern))
+			if err != nil {
+				return false, err
+			}
+			return len(matches) > 0, nil
+		},
+		"property": func(name string) string {
+			return f.Properties[name]
+		},
+	}
+
+	tmpl, err := template.New("when").Funcs(funcs).Parse(fmt.Sprintf("{{ if %s }}true{{ end }}", condition))
+	if err != nil {
+		return false, fmt.Errorf("error parsing condition %q: %w", condition, err)
+	}
+
+	var result bytes.Buffer
+	if err = tmpl.Execute(&result, f); err != nil {
+		return false, fmt.Errorf("error evaluating condition %q: %w", condition, err)
+	}
+
+	return result.String() == "true", nil
+}
+
+// matchConditions evaluates every non-empty condition and returns whether all of them matched.
+// If a condition did not match, the reason describes which one.
+func matchConditions(facts RepoFacts, conditions ...string) (bool, string, error) {
+	for _, condition := range conditions {
+		matched, err := facts.Evaluate(condition)
+		if err != nil {
+			return false, "", err
+		}
+		if !matched {
+			return false, fmt.Sprintf("condition `%s` not met", condition), nil
+		}
+	}
+
+	return true, "", nil
+}
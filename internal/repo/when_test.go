@@ -0,0 +1,41 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/repo"
+)
+
+func TestRepoFactsEvaluate(t *testing.T) {
+	facts := repo.RepoFacts{
+		Name:       "test-repo",
+		Language:   "Go",
+		Visibility: "public",
+		Archived:   false,
+		Properties: map[string]string{"team": "infra"},
+	}
+
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{``, true},
+		{`eq .Language "Go"`, true},
+		{`eq .Language "Python"`, false},
+		{`and (eq .Visibility "public") (not .Archived)`, true},
+		{`eq (property "team") "infra"`, true},
+		{`eq (property "missing") ""`, true},
+		{`exists "go.mod"`, false},
+	}
+
+	for _, test := range tests {
+		result, err := facts.Evaluate(test.condition)
+		assert.Nil(t, err, test.condition)
+		assert.Equal(t, test.expected, result, test.condition)
+	}
+
+	_, err := facts.Evaluate(`eq .Language`)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v59/github"
+
+	"github.com/chia-network/repo-content-updater/internal/config"
+)
+
+// clock returns the current time, used for CURRENT_YEAR and COPYRIGHT_YEARS
+var clock = time.Now
+
+// yearsPattern matches a year or a year range, such as 2021 or 2021-2024
+var yearsPattern = regexp.MustCompile(`\b(19|20)[0-9]{2}(\s*[-–]\s*(19|20)[0-9]{2})?\b`)
+
+// currentYear returns the current year from the clock
+func currentYear() string {
+	return strconv.Itoa(clock().Year())
+}
+
+// yearRange returns the copyright years from the start year through the current year, such as 2021-2024
+func yearRange(startYear, currentYear string) string {
+	if startYear == "" || startYear >= currentYear {
+		return currentYear
+	}
+	return fmt.Sprintf("%s-%s", startYear, currentYear)
+}
+
+// OnlyYearsChanged returns true if the two contents differ, but only in years or year ranges on
+// copyright lines. With the preserve year mode, such changes are not written so files are not updated
+// just for a new year. Numbers that look like years elsewhere, such as versions, are real changes.
+func OnlyYearsChanged(existing, updated []byte) bool {
+	if string(existing) == string(updated) {
+		return false
+	}
+
+	existingLines := strings.Split(string(existing), "\n")
+	updatedLines := strings.Split(string(updated), "\n")
+	if len(existingLines) != len(updatedLines) {
+		return false
+	}
+	for i, line := range existingLines {
+		if line == updatedLines[i] {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(line), "copyright") || !strings.Contains(strings.ToLower(updatedLines[i]), "copyright") {
+			return false
+		}
+		if yearsPattern.ReplaceAllString(line, "YEAR") != yearsPattern.ReplaceAllString(updatedLines[i], "YEAR") {
+			return false
+		}
+	}
+	return true
+}
+
+// preserveYears returns true if changes to only the years in a file should be skipped
+func preserveYears(mode string) bool {
+	return mode == config.YearModePreserve
+}
+
+// repoVariables returns the template variables for the repo, which are COPYRIGHT_YEARS if the template
+// uses it, and the repo's var_overrides
+func (c *Content) repoVariables(u *repoUpdate, tmplContent []byte) (map[string]string, error) {
+	variables := map[string]string{}
+	if c.usesVariable(tmplContent, "COPYRIGHT_YEARS") {
+		years, err := c.copyrightYears(u)
+		if err != nil {
+			return nil, err
+		}
+		variables["COPYRIGHT_YEARS"] = years
+	}
+	maps.Copy(variables, u.config.VarOverrides)
+
+	return variables, nil
+}
+
+// usesVariable returns true if the template or any partial mentions the variable, to avoid API calls
+// for variables that are not needed
+func (c *Content) usesVariable(tmplContent []byte, name string) bool {
+	if bytes.Contains(tmplContent, []byte(name)) {
+		return true
+	}
+	for _, partial := range c.partials {
+		if strings.Contains(partial, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyrightYears returns the years from the repo's first commit through the current year, such as
+// 2021-2024. The result is cached on the update, since it takes two API calls to find.
+func (c *Content) copyrightYears(u *repoUpdate) (string, error) {
+	if u.copyrightYears != "" {
+		return u.copyrightYears, nil
+	}
+
+	opts := &github.CommitsListOptions{
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	commits, resp, err := ghDo(func() ([]*github.RepositoryCommit, *github.Response, error) {
+		return c.githubClient.Repositories.ListCommits(context.TODO(), c.githubOrg, u.name, opts)
+	})
+	if err != nil {
+		return "", fmt.Errorf("error listing commits: %w", err)
+	}
+
+	// Commits are listed newest first, so the first commit is on the last page
+	if resp.LastPage > 1 {
+		opts.Page = resp.LastPage
+		commits, _, err = ghDo(func() ([]*github.RepositoryCommit, *github.Response, error) {
+			return c.githubClient.Repositories.ListCommits(context.TODO(), c.githubOrg, u.name, opts)
+		})
+		if err != nil {
+			return "", fmt.Errorf("error listing commits: %w", err)
+		}
+	}
+
+	startYear := ""
+	if len(commits) > 0 {
+		if date := commits[0].GetCommit().GetAuthor().GetDate(); !date.IsZero() {
+			startYear = strconv.Itoa(date.Year())
+		}
+	}
+
+	u.copyrightYears = yearRange(startYear, currentYear())
+	return u.copyrightYears, nil
+}
@@ -0,0 +1,194 @@
+// Package source resolves template and config locations that may live in a remote git repository
+package source
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Remote is a path within a git repository at a given ref
+type Remote struct {
+	URL  string
+	Path string
+	Ref  string
+}
+
+// remotePrefixes are the prefixes that mark a location as a git URL rather than a local path
+var remotePrefixes = []string{"https://", "http://", "ssh://", "git://", "file://", "git@"}
+
+// Parse parses a location in the form <git-url>[//<path>][?ref=<ref>], for example
+// https://github.com/Chia-Network/repo-content-updater.git//templates?ref=v1.2.0
+// The second return value is false if the location is a local path.
+func Parse(location string) (Remote, bool) {
+	isRemote := false
+	for _, prefix := range remotePrefixes {
+		if strings.HasPrefix(location, prefix) {
+			isRemote = true
+			break
+		}
+	}
+	if !isRemote {
+		return Remote{}, false
+	}
+
+	remote := Remote{URL: location}
+	if i := strings.LastIndex(remote.URL, "?ref="); i != -1 {
+		remote.Ref = remote.URL[i+len("?ref="):]
+		remote.URL = remote.URL[:i]
+	}
+
+	// Skip past the scheme separator so it is not mistaken for the path separator
+	searchFrom := 0
+	if i := strings.Index(remote.URL, "://"); i != -1 {
+		searchFrom = i + len("://")
+	}
+	if i := strings.Index(remote.URL[searchFrom:], "//"); i != -1 {
+		remote.Path = strings.Trim(remote.URL[searchFrom+i+len("//"):], "/")
+		remote.URL = remote.URL[:searchFrom+i]
+	}
+
+	return remote, true
+}
+
+// String returns the remote in the same form accepted by Parse
+func (r Remote) String() string {
+	location := r.URL
+	if r.Path != "" {
+		location = fmt.Sprintf("%s//%s", location, r.Path)
+	}
+	if r.Ref != "" {
+		location = fmt.Sprintf("%s?ref=%s", location, r.Ref)
+	}
+	return location
+}
+
+type checkout struct {
+	dir      string
+	revision string
+}
+
+// Resolver fetches remote locations into temporary directories. Each repository and ref
+// is only fetched once, so templates, partials and config from the same repository share
+// a single checkout.
+type Resolver struct {
+	token     string
+	checkouts map[string]checkout
+}
+
+// NewResolver returns a resolver that uses the given token, if set, to authenticate https remotes on github.com
+func NewResolver(token string) *Resolver {
+	return &Resolver{
+		token:     token,
+		checkouts: map[string]checkout{},
+	}
+}
+
+// Resolve returns a local path for the location. Local paths are returned unchanged with an
+// empty revision. Remote locations are fetched, and the resolved commit SHA is returned as the revision.
+func (r *Resolver) Resolve(location string) (string, string, error) {
+	remote, ok := Parse(location)
+	if !ok {
+		return location, "", nil
+	}
+
+	key := fmt.Sprintf("%s?ref=%s", remote.URL, remote.Ref)
+	co, ok := r.checkouts[key]
+	if !ok {
+		var err error
+		co, err = r.fetch(remote)
+		if err != nil {
+			return "", "", fmt.Errorf("error fetching %s: %w", remote.String(), err)
+		}
+		r.checkouts[key] = co
+	}
+
+	return filepath.Join(co.dir, filepath.FromSlash(remote.Path)), co.revision, nil
+}
+
+// Cleanup removes all temporary checkouts
+func (r *Resolver) Cleanup() {
+	for _, co := range r.checkouts {
+		_ = os.RemoveAll(co.dir)
+	}
+	r.checkouts = map[string]checkout{}
+}
+
+// UsesToken returns true if the GitHub token is sent to the remote. The token is only ever sent to
+// github.com over https, so it cannot leak to other hosts.
+func UsesToken(remoteURL string) bool {
+	parsed, err := url.Parse(remoteURL)
+	if err != nil {
+		return false
+	}
+	return parsed.Scheme == "https" && strings.EqualFold(parsed.Hostname(), "github.com")
+}
+
+func (r *Resolver) fetch(remote Remote) (checkout, error) {
+	dir, err := os.MkdirTemp("", "repo-content-updater-source-")
+	if err != nil {
+		return checkout{}, err
+	}
+
+	var auth transport.AuthMethod
+	if r.token != "" && UsesToken(remote.URL) {
+		auth = &http.BasicAuth{Username: "x-access-token", Password: r.token}
+	}
+
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:  remote.URL,
+		Auth: auth,
+		Tags: git.AllTags,
+	})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return checkout{}, err
+	}
+
+	hash, err := resolveRef(repo, remote.Ref)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return checkout{}, err
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return checkout{}, err
+	}
+	err = w.Checkout(&git.CheckoutOptions{Hash: hash, Force: true})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return checkout{}, err
+	}
+
+	return checkout{dir: dir, revision: hash.String()}, nil
+}
+
+// resolveRef resolves a branch, tag or commit SHA to a commit. An empty ref resolves to HEAD.
+func resolveRef(repo *git.Repository, ref string) (plumbing.Hash, error) {
+	if ref == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		return head.Hash(), nil
+	}
+
+	// Branches other than the default only exist as remote tracking branches in the clone
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		hash, err := repo.ResolveRevision(plumbing.Revision(candidate))
+		if err == nil {
+			return *hash, nil
+		}
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("unable to resolve ref %s", ref)
+}
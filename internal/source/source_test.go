@@ -0,0 +1,107 @@
+package source_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chia-network/repo-content-updater/internal/source"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		location string
+		expected source.Remote
+		remote   bool
+	}{
+		{"templates", source.Remote{}, false},
+		{"/abs/config.yaml", source.Remote{}, false},
+		{
+			"https://github.com/Chia-Network/repo-content-updater.git//templates?ref=v1.2.0",
+			source.Remote{URL: "https://github.com/Chia-Network/repo-content-updater.git", Path: "templates", Ref: "v1.2.0"},
+			true,
+		},
+		{
+			"https://github.com/Chia-Network/repo-content-updater.git",
+			source.Remote{URL: "https://github.com/Chia-Network/repo-content-updater.git"},
+			true,
+		},
+		{
+			"git@github.com:Chia-Network/repo-content-updater.git//config.yaml?ref=main",
+			source.Remote{URL: "git@github.com:Chia-Network/repo-content-updater.git", Path: "config.yaml", Ref: "main"},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		remote, ok := source.Parse(test.location)
+		assert.Equal(t, test.remote, ok, test.location)
+		assert.Equal(t, test.expected, remote, test.location)
+		if ok {
+			assert.Equal(t, test.location, remote.String())
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	origin := t.TempDir()
+	r, err := git.PlainInit(origin, false)
+	assert.Nil(t, err)
+	w, err := r.Worktree()
+	assert.Nil(t, err)
+
+	commitFile := func(content string) string {
+		assert.Nil(t, os.MkdirAll(filepath.Join(origin, "templates"), 0755))
+		assert.Nil(t, os.WriteFile(filepath.Join(origin, "templates", "test.yml"), []byte(content), 0644))
+		_, err := w.Add("templates/test.yml")
+		assert.Nil(t, err)
+		hash, err := w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		assert.Nil(t, err)
+		return hash.String()
+	}
+
+	first := commitFile("first")
+	_, err = r.CreateTag("v1", plumbing.NewHash(first), nil)
+	assert.Nil(t, err)
+	second := commitFile("second")
+
+	resolver := source.NewResolver("")
+	defer resolver.Cleanup()
+
+	contents := map[string]string{first: "first", second: "second"}
+	for ref, expected := range map[string]string{"": second, "v1": first, first: first} {
+		location := "file://" + origin + "//templates"
+		if ref != "" {
+			location += "?ref=" + ref
+		}
+		dir, revision, err := resolver.Resolve(location)
+		assert.Nil(t, err, location)
+		assert.Equal(t, expected, revision, location)
+
+		content, err := os.ReadFile(filepath.Join(dir, "test.yml"))
+		assert.Nil(t, err)
+		assert.Equal(t, contents[expected], string(content))
+	}
+
+	dir, revision, err := resolver.Resolve("templates")
+	assert.Nil(t, err)
+	assert.Equal(t, "templates", dir)
+	assert.Equal(t, "", revision)
+}
+
+func TestUsesToken(t *testing.T) {
+	assert.True(t, source.UsesToken("https://github.com/Chia-Network/repo-content-updater.git"))
+	assert.True(t, source.UsesToken("https://GitHub.com/Chia-Network/repo-content-updater.git"))
+	assert.False(t, source.UsesToken("https://gitlab.com/Chia-Network/repo-content-updater.git"))
+	assert.False(t, source.UsesToken("https://github.com.example.com/Chia-Network/repo-content-updater.git"))
+	assert.False(t, source.UsesToken("http://github.com/Chia-Network/repo-content-updater.git"))
+	assert.False(t, source.UsesToken("git@github.com:Chia-Network/repo-content-updater.git"))
+}